@@ -0,0 +1,130 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// checkMusicAnnouncements posts each day's prompt once the guild's announcement time has passed
+func checkMusicAnnouncements() {
+	docs, err := firestoreClient.Collection("musicconfig").Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("Something went wrong getting music configs on a cron: %v", err)
+		return
+	}
+	for _, doc := range docs {
+		config := defaultMusicConfig()
+		if err := doc.DataTo(&config); err != nil {
+			log.Printf("Couldn't read music config for %v: %v", doc.Ref.ID, err)
+			continue
+		}
+		if config.AnnounceChannel == "" {
+			continue
+		}
+		now := time.Now().In(config.location())
+		if now.Format("15:04") < config.AnnounceTime {
+			continue
+		}
+		announceMusicDay(doc.Ref.ID, config, now)
+		summariseMusicMonth(doc.Ref.ID, config, now)
+	}
+}
+
+func announceMusicDay(guildID string, config musicConfig, now time.Time) {
+	currentMonth, ok := findMusicMonth(now)
+	if !ok {
+		return
+	}
+	prompt, ok := currentMonth.prompt(now.Day())
+	if !ok {
+		return
+	}
+
+	// Claim today's announcement first so we never post it twice
+	claim := firestoreClient.Collection("musicannouncements").Doc(dayDocID(guildID, currentMonth.name(), now.Day()))
+	_, err := claim.Create(ctx, map[string]interface{}{
+		"guildID": guildID,
+		"month":   currentMonth.name(),
+		"day":     now.Day(),
+		"date":    now,
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving record to Firestore: %v", err)
+		return
+	}
+
+	var announcement strings.Builder
+	mentions := &discordgo.MessageAllowedMentions{}
+	if config.ParticipantRole != "" {
+		// Only ping the people who've signed up with /musicjoin
+		announcement.WriteString("<@&" + config.ParticipantRole + "> ")
+		mentions.Roles = []string{config.ParticipantRole}
+	}
+	announcement.WriteString("**" + now.Format("January") + " " + strconv.Itoa(now.Day()) + "**: " + prompt + "\n")
+	announcement.WriteString("Submit your pick with `/music submit`!")
+	msg, err := session.ChannelMessageSendComplex(config.AnnounceChannel, &discordgo.MessageSend{
+		Content:         truncate(announcement.String(), maxMessageLength),
+		AllowedMentions: mentions,
+	})
+	if err != nil {
+		log.Printf("Error announcing today's prompt: %v", err)
+		// Let go of the claim so the next check tries again
+		if _, err := claim.Delete(ctx); err != nil {
+			log.Printf("Error deleting record from Firestore: %v", err)
+		}
+		return
+	}
+
+	if config.Threads {
+		err = startThread(config.AnnounceChannel, msg.ID, "Day "+strconv.Itoa(now.Day())+": "+prompt)
+		if err != nil {
+			log.Printf("Couldn't start a thread for today's prompt: %v", err)
+		}
+	}
+
+	if config.Recap {
+		recapMusicDay(guildID, config, now.AddDate(0, 0, -1))
+	}
+}
+
+// recapMusicDay posts everyone's revealed picks for the given day, if there were any
+func recapMusicDay(guildID string, config musicConfig, t time.Time) {
+	recapMonth, ok := findMusicMonth(t)
+	if !ok {
+		return
+	}
+	var subs []submission
+	for _, sub := range daySubmissions(recapMonth.name(), t.Day()) {
+		if !sub.Sealed {
+			subs = append(subs, sub)
+		}
+	}
+	if len(subs) == 0 {
+		return
+	}
+
+	prompt, _ := recapMonth.prompt(t.Day())
+	// Hidden picks were already opened up for votes when they were revealed
+	postPicks(guildID, config.AnnounceChannel, "Yesterday's picks for \""+prompt+"\"", recapMonth.name(), t.Day(), subs, config.Voting && !config.Hidden)
+}
+
+// startThread opens a public thread hanging off a message. Our discordgo doesn't know about threads yet, so this goes straight to the API
+func startThread(channelID, messageID, name string) error {
+	if runes := []rune(name); len(runes) > 100 {
+		name = string(runes[:100])
+	}
+	_, err := session.RequestWithBucketID("POST", discordgo.EndpointChannelMessage(channelID, messageID)+"/threads", map[string]interface{}{
+		"name":                  name,
+		"auto_archive_duration": 1440,
+	}, discordgo.EndpointChannelMessages(channelID))
+	return err
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/bwmarrin/discordgo"
+)
+
+// monthNameFormats are the ways we'll accept a month being written
+var monthNameFormats = []string{musicMonthFormat, "January 2006", "2006-01", "01/2006", "1/2006", "Jan 06", "January 06"}
+
+// parseMonthName reads a month however it's written, returning the name its picks are stored under
+func parseMonthName(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	for _, format := range monthNameFormats {
+		if t, err := time.Parse(format, raw); err == nil {
+			return t.Format(musicMonthFormat), true
+		}
+		// People don't always bother with capitals
+		if t, err := time.Parse(format, strings.Title(strings.ToLower(raw))); err == nil {
+			return t.Format(musicMonthFormat), true
+		}
+	}
+	return "", false
+}
+
+// pastMusicMonths lists every music month that's started, newest first
+func pastMusicMonths() ([]month, error) {
+	docs, err := firestoreClient.Collection("musicmonth").Where("StartTime", "<", time.Now().UTC()).OrderBy("StartTime", firestore.Desc).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	var months []month
+	for _, doc := range docs {
+		var m month
+		if err := doc.DataTo(&m); err == nil {
+			months = append(months, m)
+		}
+	}
+	return months, nil
+}
+
+// maxChoices is the most choices Discord lets an option have
+const maxChoices = 25
+
+// archiveChoices are the months currently offered on /musicarchive, so we only re-register it when they change
+var archiveChoices []*discordgo.ApplicationCommandOptionChoice
+
+// setArchiveMonthChoices offers every past month as a choice wherever /musicarchive asks for one. Discord only accepts
+// listed choices, so once there are too many to list we leave it as free text rather than lock out the oldest months.
+// It reports whether the choices changed
+func setArchiveMonthChoices(cmd *discordgo.ApplicationCommand) bool {
+	months, err := pastMusicMonths()
+	if err != nil {
+		log.Printf("Error getting past music months: %v", err)
+		return false
+	}
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	if len(months) <= maxChoices {
+		for _, m := range months {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: m.name(), Value: m.name()})
+		}
+	}
+	if reflect.DeepEqual(choices, archiveChoices) {
+		return false
+	}
+	archiveChoices = choices
+	for _, sub := range cmd.Options {
+		for _, o := range sub.Options {
+			if o.Name == "month" {
+				o.Choices = choices
+			}
+		}
+	}
+	return true
+}
+
+// refreshArchiveCommand re-registers /musicarchive when a month's started since we last listed them
+func refreshArchiveCommand() {
+	for _, cmd := range commands {
+		if cmd.Name != "musicarchive" || !setArchiveMonthChoices(cmd) {
+			continue
+		}
+		if _, err := session.ApplicationCommandCreate(session.State.User.ID, *GuildID, cmd); err != nil {
+			log.Printf("Error updating the musicarchive command: %v", err)
+		}
+	}
+}
+
+// participants counts the members with at least one pick
+func participants(subs []submission) int {
+	users := map[string]bool{}
+	for _, sub := range subs {
+		users[sub.UserID] = true
+	}
+	return len(users)
+}
+
+// archivedMonth finds the month someone asked for, telling them off if we can't
+func archivedMonth(s *discordgo.Session, i *discordgo.InteractionCreate, raw string) (*month, bool) {
+	monthName, ok := parseMonthName(raw)
+	if !ok {
+		respondPrivately(s, i, "I don't know which month "+raw+" is - try something like Jan 2021, or see /musicarchive list")
+		return nil, false
+	}
+	m, ok := findMusicMonthByName(monthName)
+	if !ok || m.StartTime.After(time.Now().UTC()) {
+		respondPrivately(s, i, "There wasn't a music month in "+monthName+" - see /musicarchive list for the ones there were")
+		return nil, false
+	}
+	return m, true
+}
+
+func handleMusicArchive(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if firestoreClient == nil {
+		// We're not connected to GCP, don't let them do this
+		respond(s, i, "I haven't been set up to allow music months, please moan at whoever set me up")
+		return
+	}
+
+	sub := i.Data.Options[0]
+	opts := options(sub.Options)
+	switch sub.Name {
+	case "list":
+		months, err := pastMusicMonths()
+		if err != nil || len(months) == 0 {
+			respond(s, i, "No music month past or present found")
+			return
+		}
+		var lines []string
+		for _, m := range months {
+			subs := monthSubmissions(m.name())
+			lines = append(lines, "**"+m.StartTime.Format("January 2006")+"** - "+strconv.Itoa(len(m.Days))+" prompts, "+strconv.Itoa(participants(subs))+" members, "+strconv.Itoa(len(subs))+" songs")
+		}
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionApplicationCommandResponseData{
+				Embeds: []*discordgo.MessageEmbed{
+					{
+						Title: "Past music months",
+						// Years of music months would be a good problem to have, so just show the newest
+						Description: fitLines(lines, maxEmbedDescriptionLength),
+						Footer:      &discordgo.MessageEmbedFooter{Text: "Use /musicarchive month to see one in full"},
+					},
+				},
+			},
+		})
+	case "month":
+		m, ok := archivedMonth(s, i, opts["month"].StringValue())
+		if !ok {
+			return
+		}
+		subs := monthSubmissions(m.name())
+		sendCalendar(s, i, m, m.StartTime.Format("January 2006")+": "+strconv.Itoa(participants(subs))+" members picked "+strconv.Itoa(len(subs))+" songs")
+	case "playlist":
+		m, ok := archivedMonth(s, i, opts["month"].StringValue())
+		if !ok {
+			return
+		}
+		respond(s, i, "Getting your playlist for "+m.name())
+		msg, _ := s.FollowupMessageCreate(s.State.User.ID, i.Interaction, true, &discordgo.WebhookParams{
+			Content: "Working on it!",
+		})
+		day := 0
+		if o, ok := opts["day"]; ok {
+			day = int(o.IntValue())
+		}
+		switch {
+		case boolOption(opts, "mine"):
+			requestPlaylists(s, i, msg, m.name(), i.Member.User.ID, i.Member.User.Username, 0, playlistMember)
+		case day != 0:
+			requestPlaylists(s, i, msg, m.name(), "", "", day, playlistDay)
+		case boolOption(opts, "by_prompt"):
+			requestPlaylists(s, i, msg, m.name(), "", "", 0, playlistPrompts)
+		default:
+			requestPlaylists(s, i, msg, m.name(), "", "", 0, playlistMonth)
+		}
+	case "picks":
+		m, ok := archivedMonth(s, i, opts["month"].StringValue())
+		if !ok {
+			return
+		}
+		subs := enrichSubmissions(userSubmissions(i.Member.User.ID, m.name()))
+		if len(subs) == 0 {
+			respondPrivately(s, i, "You didn't pick any songs in "+m.name())
+			return
+		}
+		sort.Slice(subs, func(a, b int) bool {
+			return subs[a].Day < subs[b].Day
+		})
+		var lines []string
+		for _, sub := range subs {
+			prompt, _ := m.prompt(sub.Day)
+			lines = append(lines, "**Day "+strconv.Itoa(sub.Day)+"** ("+prompt+"): "+sub.describe())
+		}
+		// Private replies can't be paged, so this has to fit in one embed
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionApplicationCommandResponseData{
+				Flags: 64,
+				Embeds: []*discordgo.MessageEmbed{
+					{
+						Title:       "Your picks for " + m.StartTime.Format("January 2006"),
+						Description: fitLines(lines, maxEmbedDescriptionLength),
+					},
+				},
+			},
+		})
+	}
+}
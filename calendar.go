@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// daysPerCalendarPage splits a month's prompts into a page a week
+const daysPerCalendarPage = 7
+
+// Markers for a day on the calendar
+const (
+	calendarToday  = "👉"
+	calendarFilled = "✅"
+	calendarEmpty  = "▫️"
+)
+
+// pickedDays lays out which of a month's days a member has picked for, making today stand out
+func pickedDays(m *month, filled map[int]bool, today int) string {
+	var days []string
+	for _, d := range m.Days {
+		marker := calendarEmpty
+		if filled[d.Day] {
+			marker = calendarFilled
+		}
+		if d.Day == today {
+			marker = calendarToday + marker
+		}
+		days = append(days, marker+strconv.Itoa(d.Day))
+	}
+	return strings.Join(days, " ")
+}
+
+// calendarPages lays a month's prompts out a week to a page, making today stand out. today is 0 when the month isn't
+// running. It also returns the page today is on, so we can open the calendar there
+func calendarPages(m *month, today int) ([]*discordgo.MessageEmbed, int) {
+	title := "Music month: " + m.StartTime.Format("January 2006")
+	var pages []*discordgo.MessageEmbed
+	todayPage := 0
+	for start := 0; start < len(m.Days); start += daysPerCalendarPage {
+		end := start + daysPerCalendarPage
+		if end > len(m.Days) {
+			end = len(m.Days)
+		}
+		var lines []string
+		for _, d := range m.Days[start:end] {
+			line := m.StartTime.Format("Jan") + " " + strconv.Itoa(d.Day) + ": " + d.Prompt
+			if d.Day == today {
+				line = calendarToday + " **" + line + "**"
+				todayPage = len(pages)
+			}
+			lines = append(lines, line)
+		}
+		// A week of very long prompts can still be too much for one embed
+		for _, chunk := range chunkLines(lines, maxEmbedDescriptionLength) {
+			pages = append(pages, &discordgo.MessageEmbed{
+				Title:       title,
+				Description: chunk,
+			})
+		}
+	}
+	if len(pages) == 0 {
+		pages = append(pages, &discordgo.MessageEmbed{Title: title, Description: "No prompts yet"})
+	}
+	return pages, todayPage
+}
+
+// sendCalendar posts the month's calendar. Paging needs reactions on a channel message, which everyone can see, so
+// the member who asked is shown which days they've picked for in a reply only they can see, along with content
+func sendCalendar(s *discordgo.Session, i *discordgo.InteractionCreate, m *month, content string) {
+	today := 0
+	now := time.Now().In(loadMusicConfig(i.GuildID).location())
+	if m.name() == now.Format(musicMonthFormat) {
+		today = now.Day()
+	}
+	filled := map[int]bool{}
+	for _, sub := range userSubmissions(i.Member.User.ID, m.name()) {
+		filled[sub.Day] = true
+	}
+	if len(m.Days) > 0 {
+		content += "\nYour picks: " + pickedDays(m, filled, today)
+	}
+	respondPrivately(s, i, content)
+	pages, todayPage := calendarPages(m, today)
+	if _, err := sendPagesFrom(s, i.ChannelID, pages, todayPage); err != nil {
+		log.Printf("Error sending a music month calendar: %v", err)
+	}
+}
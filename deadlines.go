@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// noLateLimit means picks for a day are accepted however late they are
+const noLateLimit = -1
+
+// monthEnd is when a music month finishes in the guild's timezone
+func (c musicConfig) monthEnd(m *month) time.Time {
+	return time.Date(m.StartTime.Year(), m.StartTime.Month()+1, 1, 0, 0, 0, 0, c.location())
+}
+
+// pickMonth finds the music month a pick is for: the one running now in the guild's timezone, or the one before it for
+// late picks and withdrawals once the month's over
+func (c musicConfig) pickMonth(now time.Time, lastMonth bool) (*month, bool) {
+	now = now.In(c.location())
+	if lastMonth {
+		// Midway through the month, so the grace findMusicMonth gives can't tip us into the wrong one
+		now = time.Date(now.Year(), now.Month()-1, 15, 12, 0, 0, 0, c.location())
+	}
+	m, ok := findMusicMonth(now)
+	if !ok || m.StartTime.UTC().Month() != now.Month() || m.StartTime.UTC().Year() != now.Year() {
+		// findMusicMonth's grace can find the month after when there wasn't one
+		return nil, false
+	}
+	return m, true
+}
+
+// submissionRefusal explains why a pick for a day can't be made or withdrawn right now under the guild's rules,
+// or returns "" if it can
+func (c musicConfig) submissionRefusal(m *month, day int, now time.Time) string {
+	loc := c.location()
+	start := time.Date(m.StartTime.Year(), m.StartTime.Month(), day, 0, 0, 0, 0, loc)
+	end := start.AddDate(0, 0, 1)
+	monthEnd := c.monthEnd(m)
+
+	if c.LockAfterMonth && now.After(monthEnd) {
+		return m.StartTime.Format("January") + "'s music month is over, so picks are locked in now"
+	}
+	if !c.AllowFuture && now.Before(start) {
+		return "Day " + strconv.Itoa(day) + " hasn't started yet - you can pick for it " + relativeTime(start)
+	}
+	if c.LateHours != noLateLimit {
+		deadline := end.Add(time.Duration(c.LateHours) * time.Hour)
+		if now.After(deadline) {
+			window := "by the end of the day"
+			if c.LateHours > 0 {
+				window = "up to " + strconv.Itoa(c.LateHours) + " hours after the day ends"
+			}
+			return "Day " + strconv.Itoa(day) + " closed " + relativeTime(deadline) + " - picks are only accepted " + window
+		}
+	}
+	return ""
+}
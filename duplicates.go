@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mfcrocker/kazooiebot/links"
+)
+
+// What to do when someone picks a song that's been picked before
+const (
+	duplicatesWarn      = "warn"
+	duplicatesBlock     = "block"
+	duplicatesCelebrate = "celebrate"
+	duplicatesIgnore    = "ignore"
+)
+
+// duplicates are earlier picks of the same song, split by how close to home they are
+type duplicates struct {
+	SameDay   []submission
+	SameMonth []submission
+	Past      []submission
+	// UserID is who's picking the song now
+	UserID string
+}
+
+func (d duplicates) empty() bool {
+	return len(d.SameDay) == 0 && len(d.SameMonth) == 0 && len(d.Past) == 0
+}
+
+// findDuplicates looks for every other pick of a song, ignoring the pick this one replaces. Other people's sealed picks
+// are left out too, as even saying they exist would give them away
+func findDuplicates(link links.Link, monthName string, day int, userID string) duplicates {
+	d := duplicates{UserID: userID}
+	var subs []submission
+	docs, _ := firestoreClient.Collection("music").Where("provider", "==", string(link.Provider)).Where("linkID", "==", link.ID).Documents(ctx).GetAll()
+	for _, doc := range docs {
+		var sub submission
+		if err := doc.DataTo(&sub); err == nil {
+			subs = append(subs, sub)
+		}
+	}
+	// Picks from before we canonicalised links don't have a linkID to query on, so check this month's by parsing them
+	docs, _ = firestoreClient.Collection("music").Where("month", "==", monthName).Documents(ctx).GetAll()
+	for _, doc := range docs {
+		var sub submission
+		if err := doc.DataTo(&sub); err != nil || sub.LinkID != "" {
+			continue
+		}
+		if other, ok := sub.link(); ok && other.Provider == link.Provider && other.ID == link.ID {
+			subs = append(subs, sub)
+		}
+	}
+
+	for _, sub := range subs {
+		switch {
+		case sub.Sealed && sub.UserID != userID:
+			continue
+		case sub.Month == monthName && sub.Day == day && sub.UserID == userID:
+			continue
+		case sub.Month == monthName && sub.Day == day:
+			d.SameDay = append(d.SameDay, sub)
+		case sub.Month == monthName:
+			d.SameMonth = append(d.SameMonth, sub)
+		default:
+			d.Past = append(d.Past, sub)
+		}
+	}
+	return d
+}
+
+// onlyYours reports whether every earlier pick was made by the person picking the song now
+func (d duplicates) onlyYours() bool {
+	for _, subs := range [][]submission{d.SameDay, d.SameMonth, d.Past} {
+		for _, sub := range subs {
+			if sub.UserID != d.UserID {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// describeDuplicates explains who picked the song before
+func describeDuplicates(d duplicates) string {
+	var picks []string
+	describe := func(sub submission, when string) {
+		who := "<@" + sub.UserID + ">"
+		if sub.UserID == d.UserID {
+			who = "you"
+		}
+		picks = append(picks, who+" "+when)
+	}
+	for _, sub := range d.SameDay {
+		describe(sub, "for the same day")
+	}
+	for _, sub := range d.SameMonth {
+		describe(sub, "for day "+strconv.Itoa(sub.Day))
+	}
+	for _, sub := range d.Past {
+		describe(sub, "back in "+sub.Month)
+	}
+	const maxListed = 5
+	if len(picks) > maxListed {
+		picks = append(picks[:maxListed], "and "+strconv.Itoa(len(picks)-maxListed)+" more")
+	}
+	return strings.Join(picks, ", ")
+}
+
+// duplicateNote is what we tell the submitter about earlier picks of their song under the guild's policy
+func duplicateNote(policy string, d duplicates) string {
+	if d.empty() {
+		return ""
+	}
+	switch policy {
+	case duplicatesIgnore:
+		return ""
+	case duplicatesCelebrate:
+		return "Great minds! This was also picked by " + describeDuplicates(d)
+	case duplicatesBlock:
+		if d.onlyYours() {
+			return "You've picked that one before (" + describeDuplicates(d) + "). Try something else!"
+		}
+		return "Someone's beaten you to that one - it was picked by " + describeDuplicates(d) + ". Try something else!"
+	}
+	return "Heads up: this has already been picked by " + describeDuplicates(d)
+}
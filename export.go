@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// exportedSong is one row of an export
+type exportedSong struct {
+	Day      int    `json:"day"`
+	Prompt   string `json:"prompt"`
+	UserID   string `json:"userID"`
+	User     string `json:"user"`
+	Title    string `json:"title,omitempty"`
+	Artist   string `json:"artist,omitempty"`
+	Duration int    `json:"duration,omitempty"`
+	URL      string `json:"url"`
+}
+
+func exportRows(m *month, subs []submission) []exportedSong {
+	sort.Slice(subs, func(a, b int) bool {
+		if subs[a].Day != subs[b].Day {
+			return subs[a].Day < subs[b].Day
+		}
+		return subs[a].UserID < subs[b].UserID
+	})
+
+	usernames := map[string]string{}
+	var rows []exportedSong
+	for _, sub := range subs {
+		username, ok := usernames[sub.UserID]
+		if !ok {
+			if user, err := session.User(sub.UserID); err == nil {
+				username = user.Username
+			}
+			usernames[sub.UserID] = username
+		}
+		prompt, _ := m.prompt(sub.Day)
+		row := exportedSong{
+			Day:      sub.Day,
+			Prompt:   prompt,
+			UserID:   sub.UserID,
+			User:     username,
+			Title:    sub.Title,
+			Artist:   sub.Artist,
+			Duration: sub.seconds(),
+			URL:      sub.Song,
+		}
+		if row.Artist == "" {
+			row.Artist = sub.Channel
+		}
+		if link, ok := sub.link(); ok {
+			row.URL = link.URL
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func exportM3U(rows []exportedSong) []byte {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	for _, row := range rows {
+		duration := row.Duration
+		if duration == 0 {
+			duration = -1
+		}
+		name := row.Title
+		if name == "" {
+			name = row.URL
+		} else if row.Artist != "" {
+			name = row.Artist + " - " + row.Title
+		}
+		b.WriteString("#EXTINF:" + strconv.Itoa(duration) + "," + name + "\n")
+		b.WriteString(row.URL + "\n")
+	}
+	return []byte(b.String())
+}
+
+func exportCSV(rows []exportedSong) ([]byte, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write([]string{"day", "prompt", "user", "title", "artist", "duration", "url"})
+	for _, row := range rows {
+		w.Write([]string{strconv.Itoa(row.Day), row.Prompt, row.User, row.Title, row.Artist, strconv.Itoa(row.Duration), row.URL})
+	}
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
+
+func handleMusicExport(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if firestoreClient == nil {
+		// We're not connected to GCP, don't let them do this
+		respond(s, i, "I haven't been set up to allow music months, please moan at whoever set me up")
+		return
+	}
+	m, ok := latestMusicMonth()
+	if !ok {
+		respond(s, i, "No music month past or present found")
+		return
+	}
+
+	opts := options(i.Data.Options)
+	format := opts["format"].StringValue()
+	userID := ""
+	if opts["mine"].BoolValue() {
+		userID = i.Member.User.ID
+	}
+	day := 0
+	if o, ok := opts["day"]; ok {
+		day = int(o.IntValue())
+	}
+
+	subs := selectSubmissions(m.name(), userID, day)
+	if len(subs) == 0 {
+		respond(s, i, "There aren't any songs to export for that")
+		return
+	}
+	// Looking everything up can take longer than Discord waits for a reply. The file goes in its own message afterwards,
+	// as this version of discordgo can't attach files to interaction replies or followups
+	if userID != "" {
+		// Someone's own export can hold picks that are still sealed, so it goes to their DMs rather than the channel
+		respondPrivately(s, i, "Exporting "+strconv.Itoa(len(subs))+" of your songs from "+m.name()+", I'll DM you the file")
+	} else {
+		respond(s, i, "Exporting "+strconv.Itoa(len(subs))+" songs from "+m.name())
+	}
+	subs = enrichSubmissions(subs)
+	rows := exportRows(m, subs)
+
+	filename := "music-month-" + strings.ToLower(strings.Replace(m.name(), " ", "-", -1))
+	if userID != "" {
+		filename += "-" + i.Member.User.Username
+	}
+	if day != 0 {
+		filename += "-day-" + strconv.Itoa(day)
+	}
+
+	var data []byte
+	var contentType string
+	var err error
+	switch format {
+	case "csv":
+		data, err = exportCSV(rows)
+		contentType = "text/csv"
+	case "json":
+		data, err = json.MarshalIndent(rows, "", "  ")
+		contentType = "application/json"
+	default:
+		format = "m3u8"
+		data = exportM3U(rows)
+		contentType = "audio/x-mpegurl"
+	}
+	if err != nil {
+		s.FollowupMessageCreate(s.State.User.ID, i.Interaction, true, &discordgo.WebhookParams{
+			Content: "Something went wrong at my end so I couldn't build your export",
+		})
+		log.Printf("Error building a music export: %v", err)
+		return
+	}
+
+	channelID := i.ChannelID
+	if userID != "" {
+		channel, err := s.UserChannelCreate(userID)
+		if err != nil {
+			log.Printf("Error opening a DM for a music export: %v", err)
+			s.FollowupMessageCreate(s.State.User.ID, i.Interaction, true, &discordgo.WebhookParams{
+				Content: "Something went wrong at my end so I couldn't DM you your export",
+			})
+			return
+		}
+		channelID = channel.ID
+	}
+	_, err = s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Files: []*discordgo.File{
+			{
+				Name:        filename + "." + format,
+				ContentType: contentType,
+				Reader:      bytes.NewReader(data),
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Error sending a music export: %v", err)
+		s.FollowupMessageCreate(s.State.User.ID, i.Interaction, true, &discordgo.WebhookParams{
+			Content: exportSendFailure(err, userID != ""),
+		})
+	}
+}
+
+// exportSendFailure explains why we couldn't send someone their export file
+func exportSendFailure(err error, dm bool) string {
+	if !dm {
+		return "I couldn't post the file here - I need permission to attach files in this channel"
+	}
+	// Opening a DM works whatever their settings, it's sending to it that fails if they don't take DMs
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Message != nil && restErr.Message.Code == discordgo.ErrCodeCannotSendMessagesToThisUser {
+		return "I couldn't DM you your export, do you have DMs from server members turned off?"
+	}
+	return "Something went wrong at my end so I couldn't DM you your export"
+}
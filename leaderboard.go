@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/bwmarrin/discordgo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// memberStats sums up one member's music month
+type memberStats struct {
+	UserID        string
+	Days          map[int]bool
+	Completion    float64
+	LongestStreak int
+	CurrentStreak int
+	Votes         int
+	// Artists is how many different artists someone picked, going by YouTube channel where that's all we know
+	Artists int
+}
+
+// latestMusicMonth returns the most recent music month that has started
+func latestMusicMonth() (*month, bool) {
+	docs, err := firestoreClient.Collection("musicmonth").Where("StartTime", "<", time.Now().UTC()).OrderBy("StartTime", firestore.Desc).Limit(1).Documents(ctx).GetAll()
+	if err != nil || len(docs) == 0 {
+		return nil, false
+	}
+	var m month
+	if err := docs[0].DataTo(&m); err != nil {
+		return nil, false
+	}
+	return &m, true
+}
+
+// monthSubmissions returns every revealed pick for a month
+func monthSubmissions(monthName string) []submission {
+	docs, _ := firestoreClient.Collection("music").Where("month", "==", monthName).Documents(ctx).GetAll()
+	var subs []submission
+	for _, doc := range docs {
+		var sub submission
+		if err := doc.DataTo(&sub); err == nil && !sub.Sealed {
+			sub.ID = doc.Ref.ID
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// artistKey is who we count a pick as being by: its artist, or for YouTube the channel, or failing that the song itself
+func artistKey(sub submission) string {
+	if sub.Artist != "" {
+		return sub.Artist
+	}
+	if sub.Channel != "" {
+		return sub.Channel
+	}
+	return sub.Song
+}
+
+// monthStats works out everyone's stats for a month, best first. today is the latest day that counts towards a current streak
+func monthStats(m *month, subs []submission, today int) []*memberStats {
+	byUser := map[string]*memberStats{}
+	artists := map[string]map[string]bool{}
+	for _, sub := range subs {
+		stats, ok := byUser[sub.UserID]
+		if !ok {
+			stats = &memberStats{UserID: sub.UserID, Days: map[int]bool{}}
+			byUser[sub.UserID] = stats
+			artists[sub.UserID] = map[string]bool{}
+		}
+		stats.Days[sub.Day] = true
+		stats.Votes += sub.Votes
+		artists[sub.UserID][artistKey(sub)] = true
+	}
+
+	var all []*memberStats
+	for userID, stats := range byUser {
+		stats.Artists = len(artists[userID])
+		if len(m.Days) > 0 {
+			stats.Completion = float64(len(stats.Days)) / float64(len(m.Days)) * 100
+		}
+		streak := 0
+		for _, d := range m.Days {
+			if stats.Days[d.Day] {
+				streak++
+				if streak > stats.LongestStreak {
+					stats.LongestStreak = streak
+				}
+			} else {
+				streak = 0
+			}
+		}
+		// Today doesn't break a streak until it's over
+		for day := today; day > 0; day-- {
+			if stats.Days[day] {
+				stats.CurrentStreak++
+			} else if day != today {
+				break
+			}
+		}
+		all = append(all, stats)
+	}
+
+	sort.Slice(all, func(a, b int) bool {
+		if all[a].Completion != all[b].Completion {
+			return all[a].Completion > all[b].Completion
+		}
+		if all[a].Votes != all[b].Votes {
+			return all[a].Votes > all[b].Votes
+		}
+		return all[a].UserID < all[b].UserID
+	})
+	return all
+}
+
+func handleMusicLeaderboard(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if firestoreClient == nil {
+		// We're not connected to GCP, don't let them do this
+		respond(s, i, "I haven't been set up to allow music months, please moan at whoever set me up")
+		return
+	}
+	m, ok := latestMusicMonth()
+	if !ok {
+		respond(s, i, "No music month past or present found")
+		return
+	}
+
+	today := len(m.Days)
+	now := time.Now().UTC()
+	if m.name() == now.Format(musicMonthFormat) {
+		today = now.Day()
+	}
+	stats := monthStats(m, monthSubmissions(m.name()), today)
+	if len(stats) == 0 {
+		respond(s, i, "No-one has submitted any songs for "+m.name())
+		return
+	}
+
+	var board []string
+	for n, stat := range stats {
+		board = append(board, fmt.Sprintf("%d. <@%v> - %.0f%% done, streak %d (best %d), %d votes", n+1, stat.UserID, stat.Completion, stat.CurrentStreak, stat.LongestStreak, stat.Votes))
+	}
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionApplicationCommandResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       "Music month leaderboard: " + m.name(),
+					Description: fitLines(board, maxEmbedDescriptionLength),
+				},
+			},
+		},
+	})
+}
+
+// summaryCatchUpDays is how far into the next month we'll still post a summary we missed, eg because we were down
+const summaryCatchUpDays = 7
+
+// summariseMusicMonth posts the end-of-month awards once a music month finishes
+func summariseMusicMonth(guildID string, config musicConfig, now time.Time) {
+	if now.Day() > summaryCatchUpDays {
+		return
+	}
+	finished, ok := findMusicMonth(now.AddDate(0, 0, -now.Day()))
+	if !ok {
+		return
+	}
+
+	// Claim the summary first so we never post it twice
+	claim := firestoreClient.Collection("musicsummaries").Doc(guildID + "_" + finished.name())
+	_, err := claim.Create(ctx, map[string]interface{}{
+		"guildID": guildID,
+		"month":   finished.name(),
+		"date":    now,
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving record to Firestore: %v", err)
+		return
+	}
+
+	subs := monthSubmissions(finished.name())
+	if len(subs) == 0 {
+		return
+	}
+	stats := monthStats(finished, subs, len(finished.Days))
+
+	var summary strings.Builder
+	summary.WriteString(strconv.Itoa(len(subs)) + " songs from " + strconv.Itoa(len(stats)) + " of you. Thanks for playing!\n\n")
+
+	mostVoted := subs[0]
+	for _, sub := range subs {
+		if sub.Votes > mostVoted.Votes {
+			mostVoted = sub
+		}
+	}
+	if mostVoted.Votes > 0 {
+		prompt, _ := finished.prompt(mostVoted.Day)
+		summary.WriteString("🏆 **Most voted song**: " + mostVoted.Song + " from <@" + mostVoted.UserID + "> for \"" + prompt + "\" (" + strconv.Itoa(mostVoted.Votes) + " votes)\n")
+	}
+
+	var perfect []string
+	for _, stat := range stats {
+		if len(stat.Days) == len(finished.Days) {
+			perfect = append(perfect, "<@"+stat.UserID+">")
+		}
+	}
+	if len(perfect) > 0 {
+		summary.WriteString("📅 **Perfect attendance**: " + strings.Join(perfect, ", ") + "\n")
+	}
+
+	mostArtists := stats[0]
+	for _, stat := range stats {
+		if stat.Artists > mostArtists.Artists {
+			mostArtists = stat
+		}
+	}
+	summary.WriteString("🎤 **Most different artists**: <@" + mostArtists.UserID + "> with " + strconv.Itoa(mostArtists.Artists) + "\n")
+
+	_, err = session.ChannelMessageSendComplex(config.AnnounceChannel, &discordgo.MessageSend{
+		Embed: &discordgo.MessageEmbed{
+			Title:       "That's a wrap on " + finished.StartTime.Format("January") + "'s music month!",
+			Description: truncate(summary.String(), maxEmbedDescriptionLength),
+		},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Printf("Error posting the music month summary: %v", err)
+		// Let go of the claim so the next check tries again
+		if _, err := claim.Delete(ctx); err != nil {
+			log.Printf("Error deleting record from Firestore: %v", err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Package links recognises song links from the streaming services people post in music months,
+// reducing each to a canonical provider, ID and URL.
+package links
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Provider is a streaming service a song can be linked from
+type Provider string
+
+const (
+	YouTube    Provider = "youtube"
+	Spotify    Provider = "spotify"
+	Bandcamp   Provider = "bandcamp"
+	SoundCloud Provider = "soundcloud"
+	AppleMusic Provider = "applemusic"
+)
+
+// Link is a song link reduced to its canonical form
+type Link struct {
+	Provider Provider
+	// ID identifies the song within its provider
+	ID string
+	// URL is the canonical URL for the song
+	URL string
+}
+
+var (
+	// ErrNotALink is returned for text that isn't a URL at all
+	ErrNotALink = errors.New("not a link")
+	// ErrUnknownProvider is returned for URLs from sites we don't recognise
+	ErrUnknownProvider = errors.New("not a link from a site we recognise")
+	// ErrNotASong is returned for URLs from a site we know that don't point at a single song, eg a channel or album
+	ErrNotASong = errors.New("not a link to a single song")
+)
+
+var (
+	youTubeID = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	spotifyID = regexp.MustCompile(`^[A-Za-z0-9]{22}$`)
+	appleID   = regexp.MustCompile(`^\d+$`)
+	slug      = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// Parse recognises a song link, returning its canonical form
+func Parse(raw string) (Link, error) {
+	raw = strings.TrimSpace(raw)
+	// Discord users wrap links in <> to stop them embedding
+	raw = strings.TrimSuffix(strings.TrimPrefix(raw, "<"), ">")
+
+	if strings.HasPrefix(raw, "spotify:") {
+		return parseSpotifyURI(raw)
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || strings.ContainsAny(u.Host, " \t") {
+		return Link{}, ErrNotALink
+	}
+
+	host := strings.ToLower(u.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+	segments := pathSegments(u.Path)
+
+	switch {
+	case host == "youtube.com" || host == "m.youtube.com" || host == "music.youtube.com" || host == "youtube-nocookie.com":
+		return parseYouTube(u, segments)
+	case host == "youtu.be":
+		if len(segments) == 0 {
+			return Link{}, ErrNotASong
+		}
+		return youTubeLink(segments[0])
+	case host == "open.spotify.com" || host == "play.spotify.com":
+		return parseSpotify(segments)
+	case host == "music.apple.com" || host == "itunes.apple.com":
+		return parseAppleMusic(u, segments)
+	case host == "soundcloud.com" || host == "m.soundcloud.com":
+		return parseSoundCloud(segments)
+	case host == "on.soundcloud.com":
+		// Short links only resolve with a request, so keep them as they are
+		if len(segments) != 1 {
+			return Link{}, ErrNotASong
+		}
+		return Link{Provider: SoundCloud, ID: "on/" + segments[0], URL: "https://on.soundcloud.com/" + segments[0]}, nil
+	case strings.HasSuffix(host, ".bandcamp.com"):
+		return parseBandcamp(host, segments)
+	}
+	return Link{}, ErrUnknownProvider
+}
+
+func pathSegments(path string) []string {
+	var segments []string
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+func parseYouTube(u *url.URL, segments []string) (Link, error) {
+	if v := u.Query().Get("v"); v != "" {
+		return youTubeLink(v)
+	}
+	if len(segments) >= 2 {
+		switch segments[0] {
+		case "shorts", "embed", "v", "live", "e":
+			return youTubeLink(segments[1])
+		}
+	}
+	return Link{}, ErrNotASong
+}
+
+func youTubeLink(id string) (Link, error) {
+	if !youTubeID.MatchString(id) {
+		return Link{}, ErrNotASong
+	}
+	return Link{Provider: YouTube, ID: id, URL: "https://www.youtube.com/watch?v=" + id}, nil
+}
+
+func parseSpotify(segments []string) (Link, error) {
+	// Localised links look like /intl-de/track/ID
+	if len(segments) > 0 && strings.HasPrefix(segments[0], "intl-") {
+		segments = segments[1:]
+	}
+	if len(segments) < 2 || segments[0] != "track" {
+		return Link{}, ErrNotASong
+	}
+	return spotifyLink(segments[1])
+}
+
+func parseSpotifyURI(raw string) (Link, error) {
+	parts := strings.Split(raw, ":")
+	if len(parts) != 3 || parts[1] != "track" {
+		return Link{}, ErrNotASong
+	}
+	return spotifyLink(parts[2])
+}
+
+func spotifyLink(id string) (Link, error) {
+	if !spotifyID.MatchString(id) {
+		return Link{}, ErrNotASong
+	}
+	return Link{Provider: Spotify, ID: id, URL: "https://open.spotify.com/track/" + id}, nil
+}
+
+func parseAppleMusic(u *url.URL, segments []string) (Link, error) {
+	// Drop the storefront, eg /gb/
+	if len(segments) > 0 && len(segments[0]) == 2 {
+		segments = segments[1:]
+	}
+	if len(segments) == 0 {
+		return Link{}, ErrNotASong
+	}
+	id := ""
+	switch segments[0] {
+	case "song":
+		id = segments[len(segments)-1]
+	case "album":
+		// Songs shared from an album carry their own ID in ?i=
+		id = u.Query().Get("i")
+	}
+	if !appleID.MatchString(id) {
+		return Link{}, ErrNotASong
+	}
+	return Link{Provider: AppleMusic, ID: id, URL: "https://music.apple.com/song/" + id}, nil
+}
+
+func parseSoundCloud(segments []string) (Link, error) {
+	if len(segments) != 2 || !slug.MatchString(segments[0]) || !slug.MatchString(segments[1]) {
+		return Link{}, ErrNotASong
+	}
+	switch segments[1] {
+	case "sets", "tracks", "albums", "likes", "reposts", "popular-tracks", "followers", "following":
+		return Link{}, ErrNotASong
+	}
+	artist, track := strings.ToLower(segments[0]), strings.ToLower(segments[1])
+	return Link{Provider: SoundCloud, ID: artist + "/" + track, URL: "https://soundcloud.com/" + artist + "/" + track}, nil
+}
+
+func parseBandcamp(host string, segments []string) (Link, error) {
+	artist := strings.TrimSuffix(host, ".bandcamp.com")
+	if artist == "" || len(segments) != 2 || segments[0] != "track" || !slug.MatchString(segments[1]) {
+		return Link{}, ErrNotASong
+	}
+	return Link{Provider: Bandcamp, ID: artist + "/" + segments[1], URL: "https://" + artist + ".bandcamp.com/track/" + segments[1]}, nil
+}
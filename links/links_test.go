@@ -0,0 +1,99 @@
+package links
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	const (
+		ytID     = "dQw4w9WgXcQ"
+		ytURL    = "https://www.youtube.com/watch?v=" + ytID
+		spID     = "4cOdK2wGLETKBW3PvgPWqT"
+		spURL    = "https://open.spotify.com/track/" + spID
+		appleURL = "https://music.apple.com/song/1440833098"
+		scURL    = "https://soundcloud.com/artist/a-song"
+		bandcamp = "https://band.bandcamp.com/track/a-song"
+	)
+	tests := []struct {
+		in       string
+		provider Provider
+		id       string
+		url      string
+		err      error
+	}{
+		// YouTube, however it's shared
+		{in: ytURL, provider: YouTube, id: ytID, url: ytURL},
+		{in: "https://youtube.com/watch?v=" + ytID + "&list=PL123&index=4", provider: YouTube, id: ytID, url: ytURL},
+		{in: "https://m.youtube.com/watch?feature=share&v=" + ytID, provider: YouTube, id: ytID, url: ytURL},
+		{in: "https://music.youtube.com/watch?v=" + ytID + "&si=abc", provider: YouTube, id: ytID, url: ytURL},
+		{in: "https://youtu.be/" + ytID + "?si=abcdef", provider: YouTube, id: ytID, url: ytURL},
+		{in: "https://youtu.be/" + ytID + "?t=42", provider: YouTube, id: ytID, url: ytURL},
+		{in: "https://www.youtube.com/shorts/" + ytID, provider: YouTube, id: ytID, url: ytURL},
+		{in: "https://www.youtube-nocookie.com/embed/" + ytID, provider: YouTube, id: ytID, url: ytURL},
+		{in: "youtube.com/watch?v=" + ytID, provider: YouTube, id: ytID, url: ytURL},
+		{in: " <" + ytURL + "> ", provider: YouTube, id: ytID, url: ytURL},
+		{in: "https://WWW.YouTube.com/watch?v=" + ytID, provider: YouTube, id: ytID, url: ytURL},
+		{in: "https://www.youtube.com/channel/UC123", err: ErrNotASong},
+		{in: "https://www.youtube.com/watch?v=short", err: ErrNotASong},
+		{in: "https://youtu.be/", err: ErrNotASong},
+
+		// Spotify
+		{in: spURL, provider: Spotify, id: spID, url: spURL},
+		{in: spURL + "?si=0123456789abcdef", provider: Spotify, id: spID, url: spURL},
+		{in: "https://open.spotify.com/intl-de/track/" + spID + "?si=x", provider: Spotify, id: spID, url: spURL},
+		{in: "spotify:track:" + spID, provider: Spotify, id: spID, url: spURL},
+		{in: "spotify:album:" + spID, err: ErrNotASong},
+		{in: "https://open.spotify.com/album/" + spID, err: ErrNotASong},
+		{in: "https://open.spotify.com/track/tooshort", err: ErrNotASong},
+
+		// Apple Music
+		{in: "https://music.apple.com/gb/song/a-song/1440833098", provider: AppleMusic, id: "1440833098", url: appleURL},
+		{in: "https://music.apple.com/us/album/an-album/1440833000?i=1440833098", provider: AppleMusic, id: "1440833098", url: appleURL},
+		{in: "https://music.apple.com/us/album/an-album/1440833000", err: ErrNotASong},
+
+		// SoundCloud
+		{in: "https://soundcloud.com/Artist/A-Song?in=someone/sets/x", provider: SoundCloud, id: "artist/a-song", url: scURL},
+		{in: "https://m.soundcloud.com/artist/a-song", provider: SoundCloud, id: "artist/a-song", url: scURL},
+		{in: "https://on.soundcloud.com/AbC123", provider: SoundCloud, id: "on/AbC123", url: "https://on.soundcloud.com/AbC123"},
+		{in: "https://soundcloud.com/artist/sets", err: ErrNotASong},
+		{in: "https://soundcloud.com/artist", err: ErrNotASong},
+
+		// Bandcamp
+		{in: bandcamp + "?from=embed", provider: Bandcamp, id: "band/a-song", url: bandcamp},
+		{in: "https://band.bandcamp.com/album/an-album", err: ErrNotASong},
+
+		// Everything else
+		{in: "https://example.com/song", err: ErrUnknownProvider},
+		{in: "https://notyoutube.com/watch?v=" + ytID, err: ErrUnknownProvider},
+		{in: "", err: ErrNotALink},
+		{in: "just some words", err: ErrNotALink},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.in)
+		if err != test.err {
+			t.Errorf("Parse(%q) error = %v, want %v", test.in, err, test.err)
+			continue
+		}
+		if want := (Link{Provider: test.provider, ID: test.id, URL: test.url}); got != want {
+			t.Errorf("Parse(%q) = %+v, want %+v", test.in, got, want)
+		}
+	}
+}
+
+func TestParseIsStable(t *testing.T) {
+	// Duplicate checks and playlist matching rely on a link parsing to itself
+	for _, raw := range []string{
+		"https://youtu.be/dQw4w9WgXcQ?si=abc",
+		"spotify:track:4cOdK2wGLETKBW3PvgPWqT",
+		"https://music.apple.com/gb/album/x/1?i=1440833098",
+		"https://soundcloud.com/Artist/A-Song",
+		"https://band.bandcamp.com/track/a-song",
+	} {
+		first, err := Parse(raw)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", raw, err)
+		}
+		again, err := Parse(first.URL)
+		if err != nil || again != first {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v", first.URL, again, err, first)
+		}
+	}
+}
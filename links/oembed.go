@@ -0,0 +1,57 @@
+package links
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Info describes the song behind a link
+type Info struct {
+	Title  string
+	Artist string
+}
+
+// ErrNoLookup is returned for providers we can't look songs up on
+var ErrNoLookup = errors.New("can't look up songs from this provider")
+
+var oEmbedEndpoints = map[Provider]string{
+	YouTube:    "https://www.youtube.com/oembed?format=json&url=",
+	Spotify:    "https://open.spotify.com/oembed?url=",
+	SoundCloud: "https://soundcloud.com/oembed?format=json&url=",
+}
+
+var httpClient = &http.Client{Timeout: 2 * time.Second}
+
+// Lookup fetches a song's title and artist using the provider's oEmbed endpoint
+func Lookup(ctx context.Context, link Link) (Info, error) {
+	endpoint, ok := oEmbedEndpoints[link.Provider]
+	if !ok {
+		return Info{}, ErrNoLookup
+	}
+	req, err := http.NewRequest("GET", endpoint+url.QueryEscape(link.URL), nil)
+	if err != nil {
+		return Info{}, err
+	}
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return Info{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Info{}, fmt.Errorf("oEmbed lookup for %v returned %v", link.URL, resp.Status)
+	}
+
+	var embed struct {
+		Title      string `json:"title"`
+		AuthorName string `json:"author_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&embed); err != nil {
+		return Info{}, err
+	}
+	return Info{Title: embed.Title, Artist: embed.AuthorName}, nil
+}
@@ -0,0 +1,69 @@
+package links
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	var asked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asked = append(asked, r.URL.Query().Get("url"))
+		switch r.URL.Query().Get("url") {
+		case "https://www.youtube.com/watch?v=dQw4w9WgXcQ":
+			w.Write([]byte(`{"title": "A Song", "author_name": "A Channel"}`))
+		case "https://open.spotify.com/track/4cOdK2wGLETKBW3PvgPWqT":
+			// Spotify doesn't say who the artist is
+			w.Write([]byte(`{"title": "Another Song"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	endpoints, client := oEmbedEndpoints, httpClient
+	defer func() { oEmbedEndpoints, httpClient = endpoints, client }()
+	oEmbedEndpoints = map[Provider]string{
+		YouTube:    server.URL + "/youtube?format=json&url=",
+		Spotify:    server.URL + "/spotify?url=",
+		SoundCloud: server.URL + "/soundcloud?format=json&url=",
+	}
+	httpClient = server.Client()
+
+	tests := []struct {
+		in      string
+		want    Info
+		wantErr bool
+	}{
+		{in: "https://youtu.be/dQw4w9WgXcQ?si=abc", want: Info{Title: "A Song", Artist: "A Channel"}},
+		{in: "spotify:track:4cOdK2wGLETKBW3PvgPWqT", want: Info{Title: "Another Song"}},
+		{in: "https://soundcloud.com/artist/gone", wantErr: true},
+	}
+	for _, test := range tests {
+		link, err := Parse(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Lookup(context.Background(), link)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("Lookup(%v) = %+v, want an error", test.in, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("Lookup(%v) = %+v, %v, want %+v", test.in, got, err, test.want)
+		}
+	}
+	// Lookups always go by the canonical URL
+	if len(asked) != 3 || asked[0] != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" {
+		t.Errorf("looked up %q, want the canonical URLs", asked)
+	}
+
+	link, _ := Parse("https://band.bandcamp.com/track/a-song")
+	if _, err := Lookup(context.Background(), link); err != ErrNoLookup {
+		t.Errorf("Lookup on Bandcamp = %v, want ErrNoLookup", err)
+	}
+}
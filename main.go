@@ -11,6 +11,7 @@ import (
 	"os"
 	"os/signal"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -18,9 +19,12 @@ import (
 	"cloud.google.com/go/firestore"
 	firebase "firebase.google.com/go"
 	"github.com/bwmarrin/discordgo"
+	"github.com/mfcrocker/kazooiebot/links"
+	"github.com/mfcrocker/kazooiebot/playlist"
 	"github.com/robfig/cron/v3"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/spotify"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"google.golang.org/api/youtube/v3"
@@ -31,12 +35,17 @@ var (
 	BotToken     = flag.String("t", "", "Bot token")
 	GCPProject   = flag.String("p", "", "GCP Project")
 	YouTubeToken = flag.String("y", "", "YouTube token")
+	SpotifyToken = flag.String("s", "", "Spotify token")
 )
 
 var session *discordgo.Session
 var ctx context.Context
 var firestoreClient *firestore.Client
 var youtubeClient *youtube.Service
+var youtubeAuth *storedTokenSource
+var spotifyClient *playlist.Spotify
+var playlistProviders []playlist.Provider
+var providerAuth = map[string]*storedTokenSource{}
 
 const prettyDateFormat = "January 2, 2006"
 
@@ -50,9 +59,9 @@ type day struct {
 	Prompt string `json:"prompt"`
 }
 
-func init() { flag.Parse() }
-
-func init() {
+// connect sets up Discord, Firestore and YouTube. It's called from main rather than init so that tests, which have
+// flags of their own, don't trip over ours
+func connect() {
 	var err error
 	session, err = discordgo.New("Bot " + *BotToken)
 	if err != nil {
@@ -84,23 +93,70 @@ func init() {
 		return
 	}
 
-	if *YouTubeToken == "" {
-		url := config.AuthCodeURL("state", oauth2.AccessTypeOffline)
-		fmt.Printf("Please visit the URL for YouTube auth, then restart this with the -y flag: %v. YouTube integration will fail without the flag.", url)
-		return
+	youtubeAuth = newStoredTokenSource("youtube", config)
+	if *YouTubeToken != "" {
+		err = youtubeAuth.Exchange(*YouTubeToken)
+		if err != nil {
+			log.Printf("Couldn't connect to YouTube with the -y flag: %v", err)
+		}
+	}
+	if !youtubeAuth.Authorised() {
+		fmt.Printf("Please visit the URL for YouTube auth, then use /youtubeauth or restart this with the -y flag: %v. YouTube integration will fail until then.", youtubeAuth.AuthURL())
 	}
 
-	token, err := config.Exchange(ctx, *YouTubeToken)
+	youtubeClient, err = youtube.NewService(ctx, option.WithTokenSource(youtubeAuth))
 	if err != nil {
 		log.Printf("Couldn't connect to YouTube; YouTube integration will fail: %v", err)
 		return
 	}
+	playlistProviders = append(playlistProviders, &playlist.YouTube{Service: youtubeClient, Quota: youtubeQuota})
+	providerAuth[string(links.YouTube)] = youtubeAuth
+}
 
-	youtubeClient, err = youtube.NewService(ctx, option.WithTokenSource(config.TokenSource(ctx, token)))
+// connectSpotify sets up Spotify, which needs Firestore to keep its tokens in
+func connectSpotify() {
+	if firestoreClient == nil {
+		return
+	}
+
+	data, err := ioutil.ReadFile("spotify_secret.json")
 	if err != nil {
-		log.Printf("Couldn't connect to YouTube; YouTube integration will fail: %v", err)
+		log.Printf("Couldn't find or decode spotify_secret.json; Spotify integration will fail: %v", err)
+		return
+	}
+	var secret struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		RedirectURI  string `json:"redirect_uri"`
+	}
+	err = json.Unmarshal(data, &secret)
+	if err != nil {
+		log.Printf("Couldn't find or decode spotify_secret.json; Spotify integration will fail: %v", err)
+		return
+	}
+	config := &oauth2.Config{
+		ClientID:     secret.ClientID,
+		ClientSecret: secret.ClientSecret,
+		RedirectURL:  secret.RedirectURI,
+		Endpoint:     spotify.Endpoint,
+		Scopes:       []string{"playlist-modify-private", "playlist-modify-public"},
+	}
+
+	spotifyAuth := newStoredTokenSource("spotify", config)
+	if *SpotifyToken != "" {
+		err = spotifyAuth.Exchange(*SpotifyToken)
+		if err != nil {
+			log.Printf("Couldn't connect to Spotify with the -s flag: %v", err)
+		}
+	}
+	if !spotifyAuth.Authorised() {
+		fmt.Printf("Please visit the URL for Spotify auth, then restart this with the -s flag: %v. Spotify integration will fail until then.", spotifyAuth.AuthURL())
 		return
 	}
+
+	spotifyClient = &playlist.Spotify{Client: oauth2.NewClient(ctx, spotifyAuth)}
+	playlistProviders = append(playlistProviders, spotifyClient)
+	providerAuth[string(links.Spotify)] = spotifyAuth
 }
 
 var (
@@ -201,38 +257,322 @@ var (
 		},
 		{
 			Name:        "musicprompt",
-			Description: "Get the prompt for a music month",
+			Description: "Get a music month prompt, or suggest ones for future months",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
-					Type:        discordgo.ApplicationCommandOptionInteger,
-					Name:        "day",
-					Description: "The day to retrieve (gets today if not provided)",
-					Required:    false,
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "get",
+					Description: "Get the prompt for a day of this music month",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "day",
+							Description: "The day to retrieve (gets today if not provided)",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "suggest",
+					Description: "Suggest a prompt for a future music month",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "prompt",
+							Description: "The prompt",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "tags",
+							Description: "Categories it fits, separated by commas, eg mood, decades",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "pool",
+					Description: "See the prompts suggested so far",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "status",
+							Description: "Which prompts to see (approved if not provided)",
+							Required:    false,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "Approved", Value: promptApproved},
+								{Name: "Waiting for approval", Value: promptPending},
+								{Name: "Rejected", Value: promptRejected},
+							},
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "approve",
+					Description: "Let a suggested prompt into the pool - server managers only",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "id",
+							Description: "The prompt's number",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "tags",
+							Description: "Replace its categories, separated by commas",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "reject",
+					Description: "Keep a suggested prompt out of the pool - server managers only",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "id",
+							Description: "The prompt's number",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "draft",
+					Description: "Draft a month of prompts from the pool - mfcrocker only",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "month",
+							Description: "The month to draft, eg Mar 2021",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "tags",
+							Description: "Only use prompts in these categories, separated by commas",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "avoid_months",
+							Description: "Leave out prompts used this many months before (3 if not provided)",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "publish",
+					Description: "Make a drafted month the real thing - mfcrocker only",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "month",
+							Description: "The drafted month, eg Mar 2021",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "incomplete",
+							Description: "Publish it even if some days have no prompt",
+							Required:    false,
+						},
+					},
 				},
 			},
 		},
 		{
 			Name:        "music",
-			Description: "Set your song for a prompt",
+			Description: "Set, see or withdraw your songs for the prompts",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "song",
-					Description: "The song to submit, ideally as a YouTube link",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "submit",
+					Description: "Set your song for a prompt",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "song",
+							Description: "The song to submit, ideally as a YouTube link",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "day",
+							Description: "The day to set (sets today if not provided)",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "last_month",
+							Description: "For last month's music month, if it's still open",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "override",
+							Description: "Ignore the deadlines - server managers only",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "mine",
+					Description: "List your picks for this month",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "remove",
+					Description: "Withdraw one of your picks",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "day",
+							Description: "The day to withdraw your pick for",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "last_month",
+							Description: "For last month's music month, if it's still open",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "override",
+							Description: "Ignore the deadlines - server managers only",
+							Required:    false,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "musicplaylist",
+			Description: "Create/retrieve a playlist of your songs for the most recent music month",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "mine",
+					Description: "Whether you want the whole server's songs or just your own",
 					Required:    true,
 				},
 				{
 					Type:        discordgo.ApplicationCommandOptionInteger,
 					Name:        "day",
-					Description: "The day to set (sets today if not provided)",
+					Description: "Which day's songs to retrieve (returns every day if empty)",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "by_prompt",
+					Description: "For the whole server's month: one playlist with each day's prompt noted",
 					Required:    false,
 				},
 			},
 		},
 		{
-			Name:        "musicplaylist",
-			Description: "Create/retrieve a playlist of your songs for the most recent music month",
+			Name:        "musicarchive",
+			Description: "Look back at past music months",
 			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "List every music month so far",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "month",
+					Description: "Show a month's prompts and how many took part",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "month",
+							Description: "Which month, eg Jan 2021",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "playlist",
+					Description: "Create/retrieve a playlist for a past month",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "month",
+							Description: "Which month, eg Jan 2021",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "mine",
+							Description: "Whether you want the whole server's songs or just your own",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "day",
+							Description: "Which day's songs to retrieve (returns every day if empty)",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "by_prompt",
+							Description: "One playlist for the whole month with each day's prompt noted",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "picks",
+					Description: "See the songs you picked in a past month",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "month",
+							Description: "Which month, eg Jan 2021",
+							Required:    true,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "musicprofile",
+			Description: "See everything someone's picked across every music month",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "member",
+					Description: "Whose profile to show (yours if empty)",
+					Required:    false,
+				},
+			},
+		},
+		{
+			Name:        "musicexport",
+			Description: "Download the most recent music month's songs as a file",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "format",
+					Description: "The kind of file you want",
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "M3U8 playlist", Value: "m3u8"},
+						{Name: "CSV spreadsheet", Value: "csv"},
+						{Name: "JSON", Value: "json"},
+					},
+				},
 				{
 					Type:        discordgo.ApplicationCommandOptionBoolean,
 					Name:        "mine",
@@ -242,7 +582,227 @@ var (
 				{
 					Type:        discordgo.ApplicationCommandOptionInteger,
 					Name:        "day",
-					Description: "Which day's songs to retrieve (returns every day if empty)",
+					Description: "Which day's songs to export (exports every day if empty)",
+					Required:    false,
+				},
+			},
+		},
+		{
+			Name:        "musicleaderboard",
+			Description: "See who's keeping up with the most recent music month",
+		},
+		{
+			Name:        "musicstatus",
+			Description: "See which days of the current music month you've filled in",
+		},
+		{
+			Name:        "musicjoin",
+			Description: "Sign up for this music month and get pinged for its prompts",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "leave",
+					Description: "Drop out and stop being pinged instead",
+					Required:    false,
+				},
+			},
+		},
+		{
+			Name:        "musicnudge",
+			Description: "Get a DM in the evening if you haven't picked a song for the day",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "enabled",
+					Description: "Whether you want nudges",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "timezone",
+					Description: "Your timezone, eg Europe/London",
+					Required:    false,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "time",
+					Description: "When to nudge you, in your timezone (format: 19:00)",
+					Required:    false,
+				},
+			},
+		},
+		{
+			Name:        "musicconfig",
+			Description: "Change music month settings for this server - server managers only",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "show",
+					Description: "Show the current settings",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "announcements",
+					Description: "Post each day's prompt automatically",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionChannel,
+							Name:        "channel",
+							Description: "The channel to post prompts in",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "time",
+							Description: "The local time to post at (format: 09:00)",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "timezone",
+							Description: "The timezone for the posting time, eg Europe/London",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "threads",
+							Description: "Whether to start a thread for each day's picks",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "recap",
+							Description: "Whether to post a recap of yesterday's picks",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "off",
+							Description: "Turn announcements off",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "submissions",
+					Description: "Choose how picks are shared",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "hidden",
+							Description: "Keep picks secret until they're revealed together",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "reveal_time",
+							Description: "The local time to reveal the day's picks (format: 21:00)",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "voting",
+							Description: "Let members vote for their favourite picks once they're revealed",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "duplicates",
+							Description: "What to do when someone picks a song that's been picked before",
+							Required:    false,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "Warn them", Value: duplicatesWarn},
+								{Name: "Refuse the pick", Value: duplicatesBlock},
+								{Name: "Celebrate great minds", Value: duplicatesCelebrate},
+								{Name: "Say nothing", Value: duplicatesIgnore},
+							},
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "allow_future",
+							Description: "Whether members can pick songs for days that haven't started yet",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "late_hours",
+							Description: "How many hours after a day ends picks are still taken (-1 for any time)",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "lock_after_month",
+							Description: "Whether to stop /music last_month picks and withdrawals once the month's over",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "playlists",
+					Description: "Choose what playlists are called and who can see them",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "privacy",
+							Description: "Who can see new playlists",
+							Required:    false,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "Public", Value: playlist.Public},
+								{Name: "Unlisted", Value: playlist.Unlisted},
+								{Name: "Private", Value: playlist.Private},
+							},
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "kind",
+							Description: "Which playlists the title and description are for",
+							Required:    false,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "Whole month", Value: playlistMonth},
+								{Name: "One day", Value: playlistDay},
+								{Name: "One member", Value: playlistMember},
+								{Name: "Whole month by prompt", Value: playlistPrompts},
+							},
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "title",
+							Description: "The title, using {month}, {day}, {user}, {prompt} and {prompts} (\"default\" to reset)",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "description",
+							Description: "The description, using {month}, {day}, {user}, {prompt} and {prompts} (\"default\" to reset)",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "retitle",
+					Description: "Apply the playlist settings to playlists I've already made",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "month",
+							Description: "Only change this month's playlists (format: Jan 2021)",
+							Required:    false,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "youtubeauth",
+			Description: "Authorise me with YouTube for playlists - only works for mfcrocker",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "code",
+					Description: "The code YouTube gave you (leave empty to get the link)",
 					Required:    false,
 				},
 			},
@@ -520,31 +1080,22 @@ var (
 
 			var currentMonth month
 			docs[0].DataTo(&currentMonth)
-			var response strings.Builder
-
 			if currentMonth.StartTime.After(currentMonthEnd) {
-				response.WriteString("There's no current music month; the next begins on " + currentMonth.StartTime.Format(prettyDateFormat) + "\n")
+				sendCalendar(s, i, &currentMonth, "There's no current music month; the next begins on "+currentMonth.StartTime.Format(prettyDateFormat))
 			} else {
-				response.WriteString("Current music month: \n")
-			}
-			response.WriteString("```")
-			for _, day := range currentMonth.Days {
-				response.WriteString(currentMonth.StartTime.Format("January") + " " + strconv.Itoa(day.Day) + ": " + day.Prompt + "\n")
+				sendCalendar(s, i, &currentMonth, "Current music month:")
 			}
-			response.WriteString("```")
-
-			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionApplicationCommandResponseData{
-					Content: response.String(),
-				},
-			})
 		},
 		"musicprompt": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+			sub := i.Data.Options[0]
+			if sub.Name != "get" {
+				handleMusicPromptPool(s, i, sub)
+				return
+			}
 			now := time.Now().UTC()
 			day := now.Day()
-			if len(i.Data.Options) > 0 {
-				day = int(i.Data.Options[0].IntValue())
+			if o, ok := options(sub.Options)["day"]; ok {
+				day = int(o.IntValue())
 			}
 
 			// Give a couple of days grace on this - would normally be -now.Day() + 1
@@ -582,29 +1133,41 @@ var (
 			})
 		},
 		"music": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-			now := time.Now().UTC()
-			// Give a couple of days grace on this - would normally be -now.Day() + 1
-			currentMonthStart := now.AddDate(0, 0, -now.Day()-1)
-			currentMonthEnd := now.AddDate(0, 1, -now.Day())
-			iter := firestoreClient.Collection("musicmonth").Where("StartTime", ">", currentMonthStart).Where("StartTime", "<", currentMonthEnd).OrderBy("StartTime", firestore.Asc).Limit(1).Documents(ctx)
-			docs, _ := iter.GetAll()
-			if len(docs) == 0 {
+			sub := i.Data.Options[0]
+			switch sub.Name {
+			case "mine":
+				handleMusicMine(s, i)
+				return
+			case "remove":
+				handleMusicRemove(s, i, options(sub.Options))
+				return
+			}
+			opts := options(sub.Options)
+			config := loadMusicConfig(i.GuildID)
+			// Go by the server's own day, the same as announcements and reveals do
+			now := time.Now().In(config.location())
+			lastMonth := boolOption(opts, "last_month")
+			m, ok := config.pickMonth(now, lastMonth)
+			if !ok {
+				response := "No currently active music month"
+				if lastMonth {
+					response = "There wasn't a music month last month"
+				}
 				s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 					Type: discordgo.InteractionResponseChannelMessageWithSource,
 					Data: &discordgo.InteractionApplicationCommandResponseData{
-						Content: "No currently active music month",
+						Content: response,
 					},
 				})
 				return
 			}
 
-			var retrievedMonth month
-			docs[0].DataTo(&retrievedMonth)
+			retrievedMonth := *m
 			monthName := retrievedMonth.StartTime.Format("Jan 2006")
 			day := now.Day()
-			if len(i.Data.Options) > 1 {
-				newDay := int(i.Data.Options[1].IntValue())
-				if newDay >= 1 && newDay <= currentMonthEnd.Day() {
+			if o, ok := opts["day"]; ok {
+				newDay := int(o.IntValue())
+				if newDay >= 1 && newDay <= retrievedMonth.length() {
 					day = newDay
 				} else {
 					s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
@@ -615,31 +1178,115 @@ var (
 					})
 					return
 				}
+			} else if lastMonth {
+				respondPrivately(s, i, "Tell me which day of last month you're picking for")
+				return
+			}
+
+			song := opts["song"].StringValue()
+			link, err := links.Parse(song)
+			if err != nil {
+				respondPrivately(s, i, "I can't use "+song+" - it's "+err.Error()+". Give me a link to a song on YouTube, Spotify, Bandcamp, SoundCloud or Apple Music")
+				return
 			}
 
-			var response strings.Builder
+			overridden, ok := deadlineOverridden(s, i, opts)
+			if !ok {
+				return
+			}
+			if !overridden {
+				if refusal := config.submissionRefusal(&retrievedMonth, day, now); refusal != "" {
+					respondPrivately(s, i, refusal)
+					return
+				}
+			}
+			dupes := findDuplicates(link, monthName, day, i.Member.User.ID)
+			if config.Duplicates == duplicatesBlock && !dupes.empty() {
+				respondWithoutPings(s, i, duplicateNote(config.Duplicates, dupes), true)
+				return
+			}
 
-			iter = firestoreClient.Collection("music").Where("userID", "==", i.Member.User.ID).Where("month", "==", monthName).Where("day", "==", day).Documents(ctx)
-			docs, _ = iter.GetAll()
+			replacing := ""
+			iter := firestoreClient.Collection("music").Where("userID", "==", i.Member.User.ID).Where("month", "==", monthName).Where("day", "==", day).Documents(ctx)
+			docs, err := iter.GetAll()
+			if err != nil {
+				log.Printf("Error getting an old pick: %v", err)
+				respondPrivately(s, i, "Something went wrong at my end so I didn't save your pick")
+				return
+			}
 			if len(docs) > 0 {
-				response.WriteString("Replacing your old pick of " + docs[0].Data()["song"].(string) + "\n")
-				docs[0].Ref.Delete(ctx)
+				replacing = docs[0].Data()["song"].(string)
+				// Votes for the old pick don't carry over to the new one
+				if err := deletePick(docs[0].Ref); err != nil {
+					log.Printf("Error replacing a pick: %v", err)
+					respondPrivately(s, i, "Something went wrong at my end so I didn't save your pick")
+					return
+				}
 			}
 
-			firestoreClient.Collection("music").Add(ctx, map[string]interface{}{
-				"userID": i.Member.User.ID,
-				"month":  monthName,
-				"day":    day,
-				"song":   i.Data.Options[0].StringValue(),
-			})
+			// In hidden mode picks stay sealed until the day's reveal. Days whose reveal has been and gone won't be revealed
+			// again, so picks for those go straight out
+			sealed := config.Hidden && now.Before(config.revealTime(&retrievedMonth, day)) && !isRevealed(i.GuildID, monthName, day)
+			pick := map[string]interface{}{
+				"userID":   i.Member.User.ID,
+				"month":    monthName,
+				"day":      day,
+				"song":     song,
+				"sealed":   sealed,
+				"provider": string(link.Provider),
+				"linkID":   link.ID,
+				"url":      link.URL,
+			}
+			ref, _, err := firestoreClient.Collection("music").Add(ctx, pick)
+			if err != nil {
+				log.Printf("Error saving record to Firestore: %v", err)
+				respondPrivately(s, i, "Something went wrong at my end so I didn't save your pick")
+				return
+			}
 
-			response.WriteString("Submitting " + i.Data.Options[0].StringValue() + " for day " + strconv.Itoa(day))
-			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionApplicationCommandResponseData{
-					Content: response.String(),
-				},
-			})
+			// looked says whether we've tried to find out what the song is yet
+			reply := func(info links.Info, looked bool) string {
+				var response strings.Builder
+				if replacing != "" {
+					response.WriteString("Replacing your old pick of " + replacing + "\n")
+				}
+				response.WriteString("Submitting " + describeSong(link.URL, info) + " for day " + strconv.Itoa(day))
+				if looked && info.Title == "" && !hasPlaylistProvider(string(link.Provider)) {
+					response.WriteString("\nHeads up: I couldn't work out what this song is, so it won't make it into the playlists")
+				}
+				if note := duplicateNote(config.Duplicates, dupes); note != "" {
+					response.WriteString("\n" + note)
+				}
+				if sealed {
+					response.WriteString("\nI'll keep it under wraps until everyone's picks are revealed")
+				}
+				return response.String()
+			}
+			// Duplicate notes name whoever picked the song before, who needn't be pinged about it
+			respondWithoutPings(s, i, reply(links.Info{}, false), sealed)
+
+			// Looking the song up can take long enough that Discord gives up on us, so it's done after replying
+			go func() {
+				lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+				info, err := links.Lookup(lookupCtx, link)
+				cancel()
+				if err == nil {
+					_, err := ref.Update(ctx, []firestore.Update{{Path: "title", Value: info.Title}, {Path: "artist", Value: info.Artist}})
+					if err != nil {
+						log.Printf("Error saving song details: %v", err)
+					}
+				}
+				if !sealed {
+					monthPlaylistChanged(i.GuildID, monthName)
+				}
+				if link.Provider == links.YouTube {
+					enrichSubmissions([]submission{{ID: ref.ID, Song: link.URL, Provider: string(link.Provider), LinkID: link.ID, URL: link.URL}})
+				}
+				s.InteractionResponseEdit(s.State.User.ID, i.Interaction, &discordgo.WebhookEdit{
+					Content:         truncate(reply(info, true), maxMessageLength),
+					AllowedMentions: &discordgo.MessageAllowedMentions{},
+				})
+			}()
 		},
 		"musicplaylist": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			iter := firestoreClient.Collection("musicmonth").Where("StartTime", "<", time.Now().UTC()).OrderBy("StartTime", firestore.Desc).Limit(1).Documents(ctx)
@@ -664,17 +1311,31 @@ var (
 			docs[0].DataTo(&retrievedMonth)
 			monthName := retrievedMonth.StartTime.Format("Jan 2006")
 
-			if len(i.Data.Options) > 1 {
-				day := int(i.Data.Options[1].IntValue())
-				if i.Data.Options[0].BoolValue() {
+			opts := options(i.Data.Options)
+			if o, ok := opts["day"]; ok {
+				day := int(o.IntValue())
+				if opts["mine"].BoolValue() {
 					// Specific day, user only
 					// Don't make a playlist for one song for one person!
 					iter = firestoreClient.Collection("music").Where("userID", "==", i.Member.User.ID).Where("month", "==", monthName).Where("day", "==", day).Documents(ctx)
 					docs, _ = iter.GetAll()
 					if len(docs) > 0 {
-						s.FollowupMessageEdit(s.State.User.ID, i.Interaction, msg.ID, &discordgo.WebhookEdit{
-							Content: "Your pick for day " + strconv.Itoa(day) + " of " + monthName + " was " + docs[0].Data()["song"].(string),
-						})
+						var pick submission
+						docs[0].DataTo(&pick)
+						pick.ID = docs[0].Ref.ID
+						pick = enrichSubmissions([]submission{pick})[0]
+						edit := &discordgo.WebhookEdit{
+							Content: "Your pick for day " + strconv.Itoa(day) + " of " + monthName + " was " + pick.Song,
+						}
+						if pick.Title != "" {
+							edit.Embeds = []*discordgo.MessageEmbed{
+								{
+									Description: pick.describe(),
+									Thumbnail:   &discordgo.MessageEmbedThumbnail{URL: pick.Thumbnail},
+								},
+							}
+						}
+						s.FollowupMessageEdit(s.State.User.ID, i.Interaction, msg.ID, edit)
 						return
 					} else {
 						s.FollowupMessageEdit(s.State.User.ID, i.Interaction, msg.ID, &discordgo.WebhookEdit{
@@ -684,30 +1345,34 @@ var (
 					}
 				} else {
 					// Specific day, whole server
-					response := updateAndCreatePlaylist(monthName, "", "", day)
-					s.FollowupMessageEdit(s.State.User.ID, i.Interaction, msg.ID, &discordgo.WebhookEdit{
-						Content: response,
-					})
+					requestPlaylists(s, i, msg, monthName, "", "", day, playlistDay)
 					return
 				}
 			} else {
-				if i.Data.Options[0].BoolValue() {
+				if opts["mine"].BoolValue() {
 					// Whole month, user only
-					response := updateAndCreatePlaylist(monthName, i.Member.User.ID, i.Member.User.Username, 0)
-					s.FollowupMessageEdit(s.State.User.ID, i.Interaction, msg.ID, &discordgo.WebhookEdit{
-						Content: response,
-					})
+					requestPlaylists(s, i, msg, monthName, i.Member.User.ID, i.Member.User.Username, 0, playlistMember)
+					return
+				} else if boolOption(opts, "by_prompt") {
+					// Whole month, whole server, with the prompts
+					requestPlaylists(s, i, msg, monthName, "", "", 0, playlistPrompts)
 					return
 				} else {
 					// Whole month, whole server
-					response := updateAndCreatePlaylist(monthName, "", "", 0)
-					s.FollowupMessageEdit(s.State.User.ID, i.Interaction, msg.ID, &discordgo.WebhookEdit{
-						Content: response,
-					})
+					requestPlaylists(s, i, msg, monthName, "", "", 0, playlistMonth)
 					return
 				}
 			}
 		},
+		"musicarchive":     handleMusicArchive,
+		"musicprofile":     handleMusicProfile,
+		"musicexport":      handleMusicExport,
+		"musicleaderboard": handleMusicLeaderboard,
+		"musicstatus":      handleMusicStatus,
+		"musicnudge":       handleMusicNudge,
+		"musicjoin":        handleMusicJoin,
+		"musicconfig":      handleMusicConfig,
+		"youtubeauth":      handleYouTubeAuth,
 		"about": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 				Type: discordgo.InteractionResponseChannelMessageWithSource,
@@ -719,160 +1384,174 @@ var (
 	}
 )
 
-func updateAndCreatePlaylist(monthName, userID, username string, day int) string {
-	var iter *firestore.DocumentIterator
-	var playlistTitle string
-	var playlistDescription string
-	if userID == "" {
-		if day == 0 {
-			iter = firestoreClient.Collection("music").Where("month", "==", monthName).Documents(ctx)
-			playlistTitle = "Speedfriends Music Month: " + monthName
-			playlistDescription = "All the songs posted for " + monthName + "'s music month in Speedfriends"
-		} else {
-			iter = firestoreClient.Collection("music").Where("month", "==", monthName).Where("day", "==", day).Documents(ctx)
-			playlistTitle = "Speedfriends Music Month: " + monthName + " Day " + strconv.Itoa(day)
-			playlistDescription = "All the songs posted on day " + strconv.Itoa(day) + " of " + monthName + "'s music month in Speedfriends"
-		}
-	} else {
-		iter = firestoreClient.Collection("music").Where("userID", "==", userID).Where("month", "==", monthName).Documents(ctx)
-		playlistTitle = "Speedfriends Music Month: " + monthName + " - " + username
-		playlistDescription = "All the songs posted by " + username + " for " + monthName + "'s music month in Speedfriends"
+// updateAndCreatePlaylists brings every provider's playlist for a month, user or day up to date and links to them.
+// If a provider ran out of quota part way, it also says when to try again
+func updateAndCreatePlaylists(guildID, monthName, userID, username string, day int, kind string) (string, time.Time) {
+	if len(playlistProviders) == 0 {
+		return "I haven't been set up to make playlists, please moan at whoever set me up", time.Time{}
 	}
-	songDocs, _ := iter.GetAll()
 
-	if len(songDocs) == 0 {
+	details := playlistDetails(loadMusicConfig(guildID), monthName, username, day, kind)
+	subs := selectSubmissions(monthName, userID, day)
+
+	if len(subs) == 0 {
 		if userID == "" {
 			if day == 0 {
-				return "No-one has submitted any songs for " + monthName
+				return "No-one has submitted any songs for " + monthName, time.Time{}
 			}
-			return "No-one has submitted any songs for day " + strconv.Itoa(day) + " of " + monthName
+			return "No-one has submitted any songs for day " + strconv.Itoa(day) + " of " + monthName, time.Time{}
 		}
-		return "You haven't submitted any songs for " + monthName
+		return "You haven't submitted any songs for " + monthName, time.Time{}
+	}
+	subs = enrichSubmissions(subs)
+
+	// Let people know what they're in for
+	length := 0
+	for _, sub := range subs {
+		length += sub.seconds()
+	}
+	summary := ""
+	if length > 0 {
+		summary = " (" + strconv.Itoa(len(subs)) + " songs, " + formatDuration(time.Duration(length)*time.Second) + ")"
+	}
+	label := monthName
+	if day != 0 {
+		label += " Day " + strconv.Itoa(day)
+	}
+	if kind == playlistPrompts {
+		label += " by prompt"
 	}
 
-	iter = firestoreClient.Collection("musicplaylists").Where("userID", "==", userID).Where("month", "==", monthName).Where("day", "==", day).Documents(ctx)
+	var response []string
+	var retryAt time.Time
+	for _, p := range playlistProviders {
+		if !providerAuth[p.Name()].Authorised() {
+			response = append(response, "I've lost my "+providerNames[p.Name()]+" login, so ask mfcrocker to sort it out")
+			continue
+		}
+		playlistID, err := updateAndCreatePlaylist(p, subs, guildID, monthName, userID, day, kind, details)
+		if at, ok := quotaRetryAt(err); ok {
+			if at.After(retryAt) {
+				retryAt = at
+			}
+			line := providerNames[p.Name()] + "'s not letting me make any more changes for now, so the " + providerNames[p.Name()] + " playlist for " + label + " will be ready " + relativeTime(at)
+			if playlistID != "" {
+				line += " - what's there so far is at " + p.URL(playlistID)
+			}
+			response = append(response, line)
+			continue
+		}
+		if err != nil {
+			if playlistID != "" {
+				// Partly synced, but still worth a listen
+				response = append(response, providerNames[p.Name()]+" playlist for "+label+": "+err.Error())
+				continue
+			}
+			response = append(response, err.Error())
+			continue
+		}
+		response = append(response, providerNames[p.Name()]+" playlist for "+label+summary+": "+p.URL(playlistID))
+	}
+	return strings.Join(response, "\n"), retryAt
+}
+
+// updateAndCreatePlaylist syncs one provider's playlist with the given picks, creating it if need be
+func updateAndCreatePlaylist(p playlist.Provider, subs []submission, guildID, monthName, userID string, day int, kind string, details playlist.Details) (string, error) {
+	iter := firestoreClient.Collection("musicplaylists").Where("userID", "==", userID).Where("month", "==", monthName).Where("day", "==", day).Documents(ctx)
 	playlistDocs, _ := iter.GetAll()
 	playlistID := ""
-	if len(playlistDocs) == 0 {
+	for _, doc := range playlistDocs {
+		// Playlists from before we had more than one provider are all on YouTube
+		provider, ok := doc.Data()["provider"].(string)
+		if !ok {
+			provider = string(links.YouTube)
+		}
+		savedKind, ok := doc.Data()["kind"].(string)
+		if !ok {
+			savedKind = playlistKind(userID, day)
+		}
+		if savedKind != kind {
+			continue
+		}
+		if provider == p.Name() {
+			playlistID = doc.Data()["playlistID"].(string)
+			break
+		}
+	}
+	if playlistID == "" {
 		// Create a new playlist
-		insertPlaylist := &youtube.Playlist{
-			Snippet: &youtube.PlaylistSnippet{
-				Title:       playlistTitle,
-				Description: playlistDescription,
-			},
-			Status: &youtube.PlaylistStatus{PrivacyStatus: "unlisted"},
+		id, err := p.CreatePlaylist(details)
+		if _, ok := quotaRetryAt(err); ok {
+			return "", err
 		}
-		part := []string{"snippet", "status"}
-		call := youtubeClient.Playlists.Insert(part, insertPlaylist)
-		response, err := call.Do()
 		if err != nil {
-			log.Printf("Error creating a playlist: %v", err)
-			return "Error creating a playlist"
+			log.Printf("Error creating a %v playlist: %v", p.Name(), err)
+			return "", fmt.Errorf("Error creating a %v playlist", providerNames[p.Name()])
 		}
 		firestoreClient.Collection("musicplaylists").Add(ctx, map[string]interface{}{
+			"guildID":    guildID,
 			"userID":     userID,
 			"month":      monthName,
 			"day":        day,
-			"playlistID": response.Id,
+			"playlistID": id,
+			"provider":   p.Name(),
+			"kind":       kind,
 		})
-
-		playlistID = response.Id
-	} else {
-		playlistID = playlistDocs[0].Data()["playlistID"].(string)
+		playlistID = id
 	}
 
-	// Check all the songs on the playlist match the songs we have saved, and insert/delete as appropriate
-	pageToken := ""
-	var playlistVideos []*youtube.PlaylistItem
-	for {
-		part := []string{"contentDetails"}
-		call := youtubeClient.PlaylistItems.List(part)
-		call = call.PlaylistId(playlistID)
-		if pageToken != "" {
-			call = call.PageToken(pageToken)
-		}
-		response, err := call.Do()
-		if err != nil {
-			log.Printf("Error retrieving a playlist: %v", err)
-			return "Error retrieving a playlist"
-		}
-
-		playlistVideos = append(playlistVideos, response.Items...)
-		pageToken = response.NextPageToken
-		if pageToken == "" {
-			break
+	// Playlists run in day order
+	sort.SliceStable(subs, func(a, b int) bool {
+		return subs[a].Day < subs[b].Day
+	})
+	var trackIDs []string
+	trackSubs := map[string]submission{}
+	for _, sub := range subs {
+		if trackID, ok := trackFor(p, sub); ok {
+			trackIDs = append(trackIDs, trackID)
+			if _, ok := trackSubs[trackID]; !ok {
+				trackSubs[trackID] = sub
+			}
 		}
 	}
 
-	// Check the songs we have our end are in the playlist and add if necessary
-	for _, gcpsong := range songDocs {
-		inPlaylist := false
-		gcpID := ""
-		if strings.Contains(gcpsong.Data()["song"].(string), "youtube") {
-			gcpID = strings.Split(strings.Split(gcpsong.Data()["song"].(string), "=")[1], "&")[0]
-		} else if strings.Contains(gcpsong.Data()["song"].(string), "youtu.be") {
-			gcpID = strings.Split(gcpsong.Data()["song"].(string), "/")[3]
-		} else {
-			// Probably not YT
-			continue
-		}
-		for _, ytsong := range playlistVideos {
-			if gcpID == ytsong.ContentDetails.VideoId {
-				inPlaylist = true
-				break
-			}
-		}
-		if !inPlaylist {
-			part := []string{"snippet"}
-			video := &youtube.PlaylistItem{
-				Snippet: &youtube.PlaylistItemSnippet{
-					PlaylistId: playlistID,
-					ResourceId: &youtube.ResourceId{
-						Kind:    "youtube#video",
-						VideoId: gcpID,
-					},
-				},
-			}
-			call := youtubeClient.PlaylistItems.Insert(part, video)
-			_, err := call.Do()
-			if err != nil {
-				log.Printf("Error updating a playlist: %v", err)
-				return "Error updating a playlist"
-			}
+	// Check all the songs on the playlist match the songs we have saved, and insert/delete/reorder as appropriate
+	result, err := playlist.Sync(p, playlistID, trackIDs)
+	if _, ok := quotaRetryAt(err); ok {
+		log.Printf("Ran out of %v quota updating a playlist: %v", p.Name(), err)
+		return playlistID, err
+	}
+	if err != nil {
+		log.Printf("Error updating a %v playlist: %v", p.Name(), err)
+		if len(result.Failed) == 0 {
+			// We couldn't even see what was on it
+			return "", fmt.Errorf("Error updating a %v playlist", providerNames[p.Name()])
 		}
+		return playlistID, fmt.Errorf("%v (I couldn't make %d of the changes, so ask again later to finish it off)", p.URL(playlistID), len(result.Failed))
 	}
 
-	// Check the songs we have on YouTube's end are in GCP and delete if necessary
-	for _, ytsong := range playlistVideos {
-		inGCP := false
-		for _, gcpsong := range songDocs {
-			if strings.Contains(gcpsong.Data()["song"].(string), ytsong.ContentDetails.VideoId) {
-				inGCP = true
-				break
-			}
+	if kind == playlistPrompts {
+		// Note each song's prompt, where the provider lets us
+		_, err := playlist.Annotate(p, playlistID, promptNotes(monthName, trackSubs))
+		if _, ok := quotaRetryAt(err); ok {
+			return playlistID, err
 		}
-		if !inGCP {
-			call := youtubeClient.PlaylistItems.Delete(ytsong.Id)
-			err := call.Do()
-			if err != nil {
-				log.Printf("Error updating a playlist: %v", err)
-				return "Error updating a playlist"
-			}
+		if err != nil {
+			log.Printf("Error noting prompts on a %v playlist: %v", p.Name(), err)
 		}
 	}
-
-	if day == 0 {
-		return "Playlist for " + monthName + ": https://youtube.com/playlist?list=" + playlistID
-	}
-	return "Playlist for " + monthName + " Day " + strconv.Itoa(day) + ": https://youtube.com/playlist?list=" + playlistID
+	return playlistID, nil
 }
 
-func init() {
+func addHandlers() {
 	session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		if h, ok := commandHandlers[i.Data.Name]; ok {
 			h(s, i)
 		}
 	})
+	session.AddHandler(handleVoteAdd)
+	session.AddHandler(handleVoteRemove)
+	session.AddHandler(handlePageTurn)
 }
 
 func checkReminders() {
@@ -900,11 +1579,24 @@ func checkReminders() {
 }
 
 func main() {
+	flag.Parse()
+	connect()
+	connectSpotify()
+	addHandlers()
+
 	var c *cron.Cron
 	if firestoreClient != nil {
-		c := cron.New()
+		c = cron.New()
 		c.AddFunc("@every 1m", func() { checkReminders() })
+		c.AddFunc("@every 1m", func() { checkMusicAnnouncements() })
+		c.AddFunc("@every 1m", func() { checkMusicReveals() })
+		c.AddFunc("@every 1m", func() { checkMusicNudges() })
+		c.AddFunc("@every 1m", func() { checkQueuedPlaylists() })
+		c.AddFunc("@every 10m", func() { syncMonthPlaylists() })
+		c.AddFunc("@every 10m", func() { checkMusicRoles() })
+		c.AddFunc("@every 1h", func() { refreshArchiveCommand() })
 		c.Start()
+		go runPlaylistWorker()
 		defer firestoreClient.Close()
 	}
 	session.AddHandler(func(s *discordgo.Session, r *discordgo.Ready) {
@@ -916,6 +1608,9 @@ func main() {
 	}
 
 	for _, v := range commands {
+		if v.Name == "musicarchive" && firestoreClient != nil {
+			setArchiveMonthChoices(v)
+		}
 		_, err := session.ApplicationCommandCreate(session.State.User.ID, *GuildID, v)
 		if err != nil {
 			log.Fatalf("Couldn't create '%v' command: %v", v.Name, err)
@@ -924,7 +1619,7 @@ func main() {
 
 	defer session.Close()
 
-	stop := make(chan os.Signal)
+	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt)
 	<-stop
 	log.Println("Shutting down bird asses")
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"cloud.google.com/go/firestore"
+	"github.com/bwmarrin/discordgo"
+	"github.com/mfcrocker/kazooiebot/links"
+)
+
+const botOwnerID = "147856569730596864"
+
+const musicMonthFormat = "Jan 2006"
+
+// submission is a single song pick as stored in the music collection
+type submission struct {
+	ID     string `firestore:"-"`
+	UserID string `firestore:"userID"`
+	Month  string `firestore:"month"`
+	Day    int    `firestore:"day"`
+	Song   string `firestore:"song"`
+	Sealed bool   `firestore:"sealed"`
+	Votes  int    `firestore:"votes"`
+
+	// The canonical form of Song, for picks we recognised
+	Provider string `firestore:"provider"`
+	LinkID   string `firestore:"linkID"`
+	URL      string `firestore:"url"`
+
+	Title  string `firestore:"title"`
+	Artist string `firestore:"artist"`
+
+	// YouTube details, filled in by enrichSubmissions
+	Channel   string `firestore:"channel"`
+	Duration  int    `firestore:"duration"`
+	Thumbnail string `firestore:"thumbnail"`
+
+	// Matches holds the pick's track on other playlist providers, keyed by provider
+	Matches map[string]string `firestore:"matches"`
+}
+
+// describe names a pick for listings, eg "[Title](link) by Artist (3:45)"
+func (sub submission) describe() string {
+	if sub.Title == "" {
+		return sub.Song
+	}
+	description := sub.Title
+	if link, ok := sub.link(); ok {
+		description = "[" + sub.Title + "](" + link.URL + ")"
+	}
+	if sub.Artist != "" {
+		description += " by " + sub.Artist
+	} else if sub.Channel != "" {
+		description += " by " + sub.Channel
+	}
+	if sub.Duration > 0 {
+		description += " (" + formatDuration(time.Duration(sub.Duration)*time.Second) + ")"
+	}
+	return description
+}
+
+// seconds is how long a pick is, or 0 if we don't know
+func (sub submission) seconds() int {
+	if sub.Duration < 0 {
+		return 0
+	}
+	return sub.Duration
+}
+
+// link returns the canonical link for a pick, parsing older picks that were stored before we canonicalised them
+func (sub submission) link() (links.Link, bool) {
+	if sub.LinkID != "" {
+		return links.Link{Provider: links.Provider(sub.Provider), ID: sub.LinkID, URL: sub.URL}, true
+	}
+	link, err := links.Parse(sub.Song)
+	return link, err == nil
+}
+
+// findMusicMonth returns the music month running during t, if there is one
+func findMusicMonth(t time.Time) (*month, bool) {
+	// Give a couple of days grace on this - would normally be -t.Day() + 1
+	monthStart := t.AddDate(0, 0, -t.Day()-1)
+	monthEnd := t.AddDate(0, 1, -t.Day())
+	iter := firestoreClient.Collection("musicmonth").Where("StartTime", ">", monthStart).Where("StartTime", "<", monthEnd).OrderBy("StartTime", firestore.Asc).Limit(1).Documents(ctx)
+	docs, err := iter.GetAll()
+	if err != nil || len(docs) == 0 {
+		return nil, false
+	}
+	var m month
+	if err := docs[0].DataTo(&m); err != nil {
+		return nil, false
+	}
+	return &m, true
+}
+
+// findMusicMonthByName looks up a month from the name its picks are stored under
+func findMusicMonthByName(monthName string) (*month, bool) {
+	t, err := time.Parse(musicMonthFormat, monthName)
+	if err != nil {
+		return nil, false
+	}
+	return findMusicMonth(t)
+}
+
+// name is the key submissions for this month are stored under
+func (m *month) name() string {
+	return m.StartTime.Format(musicMonthFormat)
+}
+
+// length is how many days the month has
+func (m *month) length() int {
+	return time.Date(m.StartTime.Year(), m.StartTime.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// prompt returns the prompt for the given day, if the month has one
+func (m *month) prompt(day int) (string, bool) {
+	for _, d := range m.Days {
+		if d.Day == day {
+			return d.Prompt, true
+		}
+	}
+	return "", false
+}
+
+// dayDocID keys per-guild, per-day records such as announcements and reveals
+func dayDocID(guildID, monthName string, day int) string {
+	return fmt.Sprintf("%v_%v_%d", guildID, monthName, day)
+}
+
+// describeSong names a song as "*Title* by *Artist*" where we know them, falling back to its link
+func describeSong(song string, info links.Info) string {
+	if info.Title == "" {
+		return song
+	}
+	if info.Artist == "" {
+		return "*" + info.Title + "*"
+	}
+	return "*" + info.Title + "* by *" + info.Artist + "*"
+}
+
+// daySubmissions returns every pick for one day of a month
+func daySubmissions(monthName string, day int) []submission {
+	docs, _ := firestoreClient.Collection("music").Where("month", "==", monthName).Where("day", "==", day).Documents(ctx).GetAll()
+	var subs []submission
+	for _, doc := range docs {
+		var sub submission
+		if err := doc.DataTo(&sub); err == nil {
+			sub.ID = doc.Ref.ID
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+func respond(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionApplicationCommandResponseData{
+			Content: truncate(content, maxMessageLength),
+		},
+	})
+}
+
+// respondPrivately replies so only the user who ran the command can see it
+func respondPrivately(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionApplicationCommandResponseData{
+			Content: truncate(content, maxMessageLength),
+			Flags:   64,
+		},
+	})
+}
+
+// respondWithoutPings replies without pinging anyone it mentions, for replies that name other members
+func respondWithoutPings(s *discordgo.Session, i *discordgo.InteractionCreate, content string, private bool) {
+	data := &discordgo.InteractionApplicationCommandResponseData{
+		Content:         truncate(content, maxMessageLength),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}
+	if private {
+		data.Flags = 64
+	}
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+}
+
+// Discord's limits on what a message can hold
+const (
+	maxMessageLength          = 2000
+	maxEmbedTitleLength       = 256
+	maxEmbedDescriptionLength = 4096
+	maxEmbedFieldLength       = 1024
+)
+
+// truncate cuts text down to max characters, marking that it's been cut short
+func truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	return string([]rune(text)[:max-1]) + "…"
+}
+
+// fitLines joins as many lines as fit in max characters, saying how many more there were if they don't all fit
+func fitLines(lines []string, max int) string {
+	chunks := chunkLines(lines, max)
+	if len(chunks) <= 1 {
+		return strings.Join(chunks, "")
+	}
+	// Leave room to say what's missing, then trim off whole lines until it fits
+	for shown := strings.Count(chunks[0], "\n") + 1; shown > 0; shown-- {
+		more := "\n…and " + strconv.Itoa(len(lines)-shown) + " more"
+		chunks = chunkLines(lines[:shown], max)
+		if len(chunks) == 1 && utf8.RuneCountInString(chunks[0]+more) <= max {
+			return chunks[0] + more
+		}
+	}
+	return truncate(lines[0], max)
+}
+
+// chunkLines joins lines into as few chunks as it can without any going over max characters. A single line that's too
+// long on its own is cut short
+func chunkLines(lines []string, max int) []string {
+	var chunks []string
+	var chunk strings.Builder
+	length := 0
+	for _, line := range lines {
+		line = truncate(line, max)
+		lineLength := utf8.RuneCountInString(line)
+		if length > 0 && length+1+lineLength > max {
+			chunks = append(chunks, chunk.String())
+			chunk.Reset()
+			length = 0
+		}
+		if length > 0 {
+			chunk.WriteString("\n")
+			length++
+		}
+		chunk.WriteString(line)
+		length += lineLength
+	}
+	if length > 0 {
+		chunks = append(chunks, chunk.String())
+	}
+	return chunks
+}
+
+// options flattens a command or subcommand's options by name
+func options(opts []*discordgo.ApplicationCommandInteractionDataOption) map[string]*discordgo.ApplicationCommandInteractionDataOption {
+	m := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(opts))
+	for _, o := range opts {
+		m[o.Name] = o
+	}
+	return m
+}
+
+// boolOption reads an optional boolean option, which Discord leaves out altogether when it isn't given
+func boolOption(opts map[string]*discordgo.ApplicationCommandInteractionDataOption, name string) bool {
+	o, ok := opts[name]
+	return ok && o.BoolValue()
+}
+
+// isMusicAdmin reports whether the user running the command may manage music months
+func isMusicAdmin(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	if i.Member.User.ID == botOwnerID {
+		return true
+	}
+	perms, err := s.UserChannelPermissions(i.Member.User.ID, i.ChannelID)
+	if err != nil {
+		return false
+	}
+	return perms&discordgo.PermissionManageServer != 0
+}
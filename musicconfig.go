@@ -0,0 +1,266 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mfcrocker/kazooiebot/playlist"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// musicConfig holds a guild's music month settings, stored in musicconfig keyed by guild ID
+type musicConfig struct {
+	AnnounceChannel string `firestore:"announceChannel"`
+	AnnounceTime    string `firestore:"announceTime"`
+	Timezone        string `firestore:"timezone"`
+	Threads         bool   `firestore:"threads"`
+	Recap           bool   `firestore:"recap"`
+	Hidden          bool   `firestore:"hidden"`
+	RevealTime      string `firestore:"revealTime"`
+	Voting          bool   `firestore:"voting"`
+	Duplicates      string `firestore:"duplicates"`
+	AllowFuture     bool   `firestore:"allowFuture"`
+	// LateHours is how long after a day ends picks for it are still accepted, or noLateLimit
+	LateHours       int    `firestore:"lateHours"`
+	LockAfterMonth  bool   `firestore:"lockAfterMonth"`
+	PlaylistPrivacy string `firestore:"playlistPrivacy"`
+	// PlaylistTitles and PlaylistDescriptions are templates keyed by kind of playlist, falling back to the defaults
+	PlaylistTitles       map[string]string `firestore:"playlistTitles"`
+	PlaylistDescriptions map[string]string `firestore:"playlistDescriptions"`
+	// ParticipantRole is the role members get with /musicjoin, made the first time someone joins
+	ParticipantRole string `firestore:"participantRole"`
+}
+
+var timeOfDayFormat = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+
+func defaultMusicConfig() musicConfig {
+	return musicConfig{
+		AnnounceTime:    "09:00",
+		RevealTime:      "21:00",
+		Duplicates:      duplicatesWarn,
+		AllowFuture:     true,
+		LateHours:       noLateLimit,
+		Timezone:        "UTC",
+		PlaylistPrivacy: playlist.Unlisted,
+	}
+}
+
+func loadMusicConfig(guildID string) musicConfig {
+	config := defaultMusicConfig()
+	doc, err := firestoreClient.Collection("musicconfig").Doc(guildID).Get(ctx)
+	if err != nil {
+		if status.Code(err) != codes.NotFound {
+			log.Printf("Error loading music config for %v: %v", guildID, err)
+		}
+		return config
+	}
+	doc.DataTo(&config)
+	return config
+}
+
+func saveMusicConfig(guildID string, config musicConfig) error {
+	_, err := firestoreClient.Collection("musicconfig").Doc(guildID).Set(ctx, config)
+	return err
+}
+
+// location is the guild's configured timezone, falling back to UTC
+func (c musicConfig) location() *time.Location {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (c musicConfig) String() string {
+	var b strings.Builder
+	b.WriteString("Announcement channel: ")
+	if c.AnnounceChannel == "" {
+		b.WriteString("none (announcements are off)")
+	} else {
+		b.WriteString("<#" + c.AnnounceChannel + ">")
+	}
+	b.WriteString("\nAnnouncement time: " + c.AnnounceTime + " " + c.Timezone)
+	if c.ParticipantRole == "" {
+		b.WriteString("\nPings: nobody's used /musicjoin yet")
+	} else {
+		b.WriteString("\nPings: <@&" + c.ParticipantRole + ">")
+	}
+	b.WriteString("\nDaily threads: " + yesNo(c.Threads))
+	b.WriteString("\nRecap yesterday's picks: " + yesNo(c.Recap))
+	b.WriteString("\nHidden picks: " + yesNo(c.Hidden))
+	if c.Hidden {
+		b.WriteString(", revealed at " + c.RevealTime + " " + c.Timezone)
+	}
+	b.WriteString("\nVoting: " + yesNo(c.Voting))
+	b.WriteString("\nRepeated songs: " + c.Duplicates)
+	b.WriteString("\nPicks for future days: " + yesNo(c.AllowFuture))
+	if c.LateHours == noLateLimit {
+		b.WriteString("\nLate picks: any time")
+	} else {
+		b.WriteString("\nLate picks: up to " + strconv.Itoa(c.LateHours) + " hours after the day")
+	}
+	b.WriteString("\nLocked once the month's over: " + yesNo(c.LockAfterMonth))
+	b.WriteString("\nPlaylists: " + c.PlaylistPrivacy)
+	for _, kind := range []string{playlistMonth, playlistDay, playlistMember, playlistPrompts} {
+		if title, ok := c.PlaylistTitles[kind]; ok {
+			b.WriteString("\n" + strings.Title(kind) + " playlist title: " + title)
+		}
+		if description, ok := c.PlaylistDescriptions[kind]; ok {
+			b.WriteString("\n" + strings.Title(kind) + " playlist description: " + description)
+		}
+	}
+	return b.String()
+}
+
+// setTemplate sets or, for "default", clears a playlist template
+func setTemplate(templates map[string]string, kind, template string) map[string]string {
+	if templates == nil {
+		templates = map[string]string{}
+	}
+	if strings.EqualFold(template, "default") {
+		delete(templates, kind)
+	} else {
+		templates[kind] = template
+	}
+	return templates
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func handleMusicConfig(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if firestoreClient == nil {
+		// We're not connected to GCP, don't let them do this
+		respond(s, i, "I haven't been set up to allow music months, please moan at whoever set me up")
+		return
+	}
+	if !isMusicAdmin(s, i) {
+		respondPrivately(s, i, "Only server managers can change music month settings")
+		return
+	}
+
+	config := loadMusicConfig(i.GuildID)
+	sub := i.Data.Options[0]
+	opts := options(sub.Options)
+	switch sub.Name {
+	case "show":
+		respondPrivately(s, i, config.String())
+		return
+	case "announcements":
+		if o, ok := opts["channel"]; ok {
+			config.AnnounceChannel = o.ChannelValue(nil).ID
+		}
+		if o, ok := opts["time"]; ok {
+			if !timeOfDayFormat.MatchString(o.StringValue()) {
+				respondPrivately(s, i, "Give me a time in 24 hour HH:MM format, eg 09:00")
+				return
+			}
+			config.AnnounceTime = o.StringValue()
+		}
+		if o, ok := opts["timezone"]; ok {
+			if _, err := time.LoadLocation(o.StringValue()); err != nil {
+				respondPrivately(s, i, "I don't know the timezone "+o.StringValue()+" - try something like Europe/London")
+				return
+			}
+			config.Timezone = o.StringValue()
+		}
+		if o, ok := opts["threads"]; ok {
+			config.Threads = o.BoolValue()
+		}
+		if o, ok := opts["recap"]; ok {
+			config.Recap = o.BoolValue()
+		}
+		if o, ok := opts["off"]; ok && o.BoolValue() {
+			config.AnnounceChannel = ""
+		}
+	case "submissions":
+		if o, ok := opts["hidden"]; ok {
+			config.Hidden = o.BoolValue()
+		}
+		if o, ok := opts["reveal_time"]; ok {
+			if !timeOfDayFormat.MatchString(o.StringValue()) {
+				respondPrivately(s, i, "Give me a time in 24 hour HH:MM format, eg 21:00")
+				return
+			}
+			config.RevealTime = o.StringValue()
+		}
+		if o, ok := opts["voting"]; ok {
+			config.Voting = o.BoolValue()
+		}
+		if o, ok := opts["duplicates"]; ok {
+			config.Duplicates = o.StringValue()
+		}
+		if o, ok := opts["allow_future"]; ok {
+			config.AllowFuture = o.BoolValue()
+		}
+		if o, ok := opts["late_hours"]; ok {
+			if o.IntValue() < noLateLimit {
+				respondPrivately(s, i, "Give me a number of hours, or -1 to take late picks any time")
+				return
+			}
+			config.LateHours = int(o.IntValue())
+		}
+		if o, ok := opts["lock_after_month"]; ok {
+			config.LockAfterMonth = o.BoolValue()
+		}
+		if (config.Hidden || config.Voting) && config.AnnounceChannel == "" {
+			respondPrivately(s, i, "Set an announcement channel first so I've somewhere to post the picks")
+			return
+		}
+	case "playlists":
+		if o, ok := opts["privacy"]; ok {
+			config.PlaylistPrivacy = o.StringValue()
+		}
+		_, hasTitle := opts["title"]
+		_, hasDescription := opts["description"]
+		kind, ok := opts["kind"]
+		if (hasTitle || hasDescription) && !ok {
+			respondPrivately(s, i, "Tell me which kind of playlist that's for")
+			return
+		}
+		if hasTitle {
+			config.PlaylistTitles = setTemplate(config.PlaylistTitles, kind.StringValue(), opts["title"].StringValue())
+		}
+		if hasDescription {
+			config.PlaylistDescriptions = setTemplate(config.PlaylistDescriptions, kind.StringValue(), opts["description"].StringValue())
+		}
+	case "retitle":
+		monthName := ""
+		if o, ok := opts["month"]; ok {
+			if _, err := time.Parse(musicMonthFormat, o.StringValue()); err != nil {
+				respondPrivately(s, i, "Give me a month like Jan 2021")
+				return
+			}
+			monthName = o.StringValue()
+		}
+		// Every playlist costs quota, so this can take a while, and it waits its turn behind any playlists being built
+		response := "Updating playlists, hang on"
+		if ahead := playlistsQueued(); ahead > 0 {
+			response += " - there's " + strconv.Itoa(ahead) + " other playlist(s) to get through first"
+		}
+		respondPrivately(s, i, response)
+		queueRetitle(i.GuildID, monthName, func(response string, retryAt time.Time) {
+			s.InteractionResponseEdit(s.State.User.ID, i.Interaction, &discordgo.WebhookEdit{
+				Content: truncate(response, maxMessageLength),
+			})
+		})
+		return
+	}
+
+	if err := saveMusicConfig(i.GuildID, config); err != nil {
+		respondPrivately(s, i, "Something went wrong at my end so I didn't save the settings")
+		log.Printf("Error saving record to Firestore: %v", err)
+		return
+	}
+	respondPrivately(s, i, "Settings saved:\n"+config.String())
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/bwmarrin/discordgo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// nudgeSettings is a member's opt-in for missed-day reminders, stored in musicnudges keyed by user ID
+type nudgeSettings struct {
+	Enabled    bool   `firestore:"enabled"`
+	Timezone   string `firestore:"timezone"`
+	Time       string `firestore:"time"`
+	LastNudged string `firestore:"lastNudged"`
+}
+
+func defaultNudgeSettings() nudgeSettings {
+	return nudgeSettings{
+		Timezone: "UTC",
+		Time:     "19:00",
+	}
+}
+
+func (n nudgeSettings) location() *time.Location {
+	loc, err := time.LoadLocation(n.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// userSubmissions returns every pick a member has made for a month
+func userSubmissions(userID, monthName string) []submission {
+	docs, _ := firestoreClient.Collection("music").Where("userID", "==", userID).Where("month", "==", monthName).Documents(ctx).GetAll()
+	var subs []submission
+	for _, doc := range docs {
+		var sub submission
+		if err := doc.DataTo(&sub); err == nil {
+			sub.ID = doc.Ref.ID
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// checkMusicNudges DMs opted-in members who haven't picked a song for today once their evening comes round
+func checkMusicNudges() {
+	docs, err := firestoreClient.Collection("musicnudges").Where("enabled", "==", true).Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("Something went wrong getting music nudges on a cron: %v", err)
+		return
+	}
+	// Nudges aren't tied to a server, so they go by the home one's
+	config := loadMusicConfig(*GuildID)
+	for _, doc := range docs {
+		settings := defaultNudgeSettings()
+		if err := doc.DataTo(&settings); err != nil {
+			continue
+		}
+		now := time.Now().In(settings.location())
+		today := now.Format("2006-01-02")
+		if settings.LastNudged == today || now.Format("15:04") < settings.Time {
+			continue
+		}
+		doc.Ref.Update(ctx, []firestore.Update{{Path: "lastNudged", Value: today}})
+
+		// The member's timezone only says when to nudge them. Which day's prompt it is goes by the server's, the same as
+		// submitting does
+		guildNow := time.Now().In(config.location())
+		currentMonth, ok := config.pickMonth(guildNow, false)
+		if !ok {
+			continue
+		}
+		prompt, ok := currentMonth.prompt(guildNow.Day())
+		if !ok {
+			continue
+		}
+		picked, _ := firestoreClient.Collection("music").Where("userID", "==", doc.Ref.ID).Where("month", "==", currentMonth.name()).Where("day", "==", guildNow.Day()).Documents(ctx).GetAll()
+		if len(picked) > 0 {
+			continue
+		}
+
+		channel, err := session.UserChannelCreate(doc.Ref.ID)
+		if err != nil {
+			log.Printf("Couldn't talk to user: %v", err)
+			continue
+		}
+		_, err = session.ChannelMessageSend(channel.ID, truncate("Psst! You haven't picked a song for today's music month prompt yet: "+prompt+"\nUse `/music submit` to submit one, or `/musicnudge enabled:false` to stop these reminders", maxMessageLength))
+		if err != nil {
+			log.Printf("Error trying to nudge someone: %v", err)
+		}
+	}
+}
+
+func handleMusicNudge(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if firestoreClient == nil {
+		// We're not connected to GCP, don't let them do this
+		respond(s, i, "I haven't been set up to allow music months, please moan at whoever set me up")
+		return
+	}
+	ref := firestoreClient.Collection("musicnudges").Doc(i.Member.User.ID)
+	settings := defaultNudgeSettings()
+	doc, err := ref.Get(ctx)
+	if err == nil {
+		doc.DataTo(&settings)
+	} else if status.Code(err) != codes.NotFound {
+		respondPrivately(s, i, "Something went wrong at my end so I couldn't find your settings")
+		log.Printf("Error loading record from Firestore: %v", err)
+		return
+	}
+
+	opts := options(i.Data.Options)
+	settings.Enabled = opts["enabled"].BoolValue()
+	if o, ok := opts["timezone"]; ok {
+		if _, err := time.LoadLocation(o.StringValue()); err != nil {
+			respondPrivately(s, i, "I don't know the timezone "+o.StringValue()+" - try something like Europe/London")
+			return
+		}
+		settings.Timezone = o.StringValue()
+	}
+	if o, ok := opts["time"]; ok {
+		if !timeOfDayFormat.MatchString(o.StringValue()) {
+			respondPrivately(s, i, "Give me a time in 24 hour HH:MM format, eg 19:00")
+			return
+		}
+		settings.Time = o.StringValue()
+	}
+
+	if _, err := ref.Set(ctx, settings); err != nil {
+		respondPrivately(s, i, "Something went wrong at my end so I didn't save your settings")
+		log.Printf("Error saving record to Firestore: %v", err)
+		return
+	}
+	if !settings.Enabled {
+		respondPrivately(s, i, "Okay, no more nudges")
+		return
+	}
+	respondPrivately(s, i, "Okay, I'll DM you at "+settings.Time+" "+settings.Timezone+" on days you haven't picked a song yet")
+}
+
+func handleMusicStatus(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if firestoreClient == nil {
+		// We're not connected to GCP, don't let them do this
+		respond(s, i, "I haven't been set up to allow music months, please moan at whoever set me up")
+		return
+	}
+	now := time.Now().UTC()
+	currentMonth, ok := findMusicMonth(now)
+	if !ok {
+		respondPrivately(s, i, "No currently active music month")
+		return
+	}
+
+	subs := userSubmissions(i.Member.User.ID, currentMonth.name())
+	stats := monthStats(currentMonth, subs, now.Day())
+	filled := map[int]bool{}
+	streak := 0
+	if len(stats) > 0 {
+		filled = stats[0].Days
+		streak = stats[0].CurrentStreak
+	}
+
+	var filledDays, missingDays []string
+	for _, d := range currentMonth.Days {
+		if filled[d.Day] {
+			filledDays = append(filledDays, strconv.Itoa(d.Day))
+		} else if d.Day <= now.Day() {
+			missingDays = append(missingDays, strconv.Itoa(d.Day))
+		}
+	}
+
+	var response strings.Builder
+	response.WriteString("Your " + currentMonth.name() + " so far:\n")
+	response.WriteString("Filled in: " + joinOrNone(filledDays) + "\n")
+	response.WriteString("Missing: " + joinOrNone(missingDays) + "\n")
+	response.WriteString("Current streak: " + strconv.Itoa(streak) + " days")
+	respondPrivately(s, i, response.String())
+}
+
+func joinOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
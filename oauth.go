@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errNotAuthorised is returned for tokens nobody has authorised yet
+var errNotAuthorised = errors.New("not authorised yet")
+
+// storedToken is an OAuth token as kept in the oauthtokens collection
+type storedToken struct {
+	AccessToken  string    `firestore:"accessToken"`
+	TokenType    string    `firestore:"tokenType"`
+	RefreshToken string    `firestore:"refreshToken"`
+	Expiry       time.Time `firestore:"expiry"`
+}
+
+// storedTokenSource is a token source that keeps its token in Firestore, so we stay authorised across restarts.
+// Refreshed tokens are saved as they come in
+type storedTokenSource struct {
+	name   string
+	config *oauth2.Config
+
+	mu     sync.Mutex
+	source oauth2.TokenSource
+	saved  string
+}
+
+// newStoredTokenSource picks up any token saved under name
+func newStoredTokenSource(name string, config *oauth2.Config) *storedTokenSource {
+	s := &storedTokenSource{name: name, config: config}
+	doc, err := firestoreClient.Collection("oauthtokens").Doc(name).Get(ctx)
+	if err != nil {
+		if status.Code(err) != codes.NotFound {
+			log.Printf("Couldn't load the saved %v token: %v", name, err)
+		}
+		return s
+	}
+	var stored storedToken
+	if err := doc.DataTo(&stored); err != nil {
+		log.Printf("Couldn't load the saved %v token: %v", name, err)
+		return s
+	}
+	token := &oauth2.Token{
+		AccessToken:  stored.AccessToken,
+		TokenType:    stored.TokenType,
+		RefreshToken: stored.RefreshToken,
+		Expiry:       stored.Expiry,
+	}
+	s.source = config.TokenSource(ctx, token)
+	s.saved = token.AccessToken
+	return s
+}
+
+func (s *storedTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.source == nil {
+		return nil, errNotAuthorised
+	}
+	token, err := s.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken != s.saved {
+		s.save(token)
+	}
+	return token, nil
+}
+
+// save must be called with mu held
+func (s *storedTokenSource) save(token *oauth2.Token) {
+	_, err := firestoreClient.Collection("oauthtokens").Doc(s.name).Set(ctx, storedToken{
+		AccessToken:  token.AccessToken,
+		TokenType:    token.TokenType,
+		RefreshToken: token.RefreshToken,
+		Expiry:       token.Expiry,
+	})
+	if err != nil {
+		log.Printf("Couldn't save the %v token: %v", s.name, err)
+		return
+	}
+	s.saved = token.AccessToken
+}
+
+// Authorised reports whether we have a token to work with. Providers that don't need one have no source at all
+func (s *storedTokenSource) Authorised() bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.source != nil
+}
+
+// AuthURL is where an admin goes to authorise us
+func (s *storedTokenSource) AuthURL() string {
+	// Forcing the consent screen makes sure we get a refresh token back every time
+	return s.config.AuthCodeURL("state", oauth2.AccessTypeOffline, oauth2.ApprovalForce)
+}
+
+// Exchange trades an auth code for a token and saves it
+func (s *storedTokenSource) Exchange(code string) error {
+	token, err := s.config.Exchange(ctx, strings.TrimSpace(code))
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.source = s.config.TokenSource(ctx, token)
+	s.save(token)
+	return nil
+}
+
+func handleYouTubeAuth(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Member.User.ID != botOwnerID {
+		// You ain't me
+		respondPrivately(s, i, "Please ask mfcrocker to set this up!")
+		return
+	}
+	if youtubeAuth == nil {
+		respondPrivately(s, i, "I haven't got a client_secret.json, so there's nothing to authorise")
+		return
+	}
+
+	opts := options(i.Data.Options)
+	code, ok := opts["code"]
+	if !ok {
+		state := "I'm not authorised with YouTube right now."
+		if youtubeAuth.Authorised() {
+			state = "I'm already authorised with YouTube, and I've used about " + strconv.Itoa(youtubeQuota.Used()) + " units of quota today. You can authorise me again if you like."
+		}
+		respondPrivately(s, i, state+" Visit "+youtubeAuth.AuthURL()+" then run `/youtubeauth` again with the code it gives you")
+		return
+	}
+	if err := youtubeAuth.Exchange(code.StringValue()); err != nil {
+		log.Printf("Couldn't exchange a YouTube auth code: %v", err)
+		respondPrivately(s, i, "YouTube didn't accept that code - try getting a fresh one")
+		return
+	}
+	respondPrivately(s, i, "Okay, I'm authorised with YouTube and I'll stay that way across restarts")
+}
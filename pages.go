@@ -0,0 +1,94 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Reactions for flicking through a paged message
+const (
+	pagePrevious = "◀️"
+	pageNext     = "▶️"
+)
+
+// pagedMessageLifetime is how long people can flick through a paged message before it stops responding
+const pagedMessageLifetime = time.Hour
+
+// pagedMessage is an embed split over pages that members can flick through with reactions. They're only kept in memory,
+// so they stop turning after a restart
+type pagedMessage struct {
+	pages   []*discordgo.MessageEmbed
+	current int
+	expires time.Time
+}
+
+var pagedMessages = struct {
+	sync.Mutex
+	messages map[string]*pagedMessage
+}{messages: map[string]*pagedMessage{}}
+
+// sendPages posts the first page to a channel, adding page numbers and reactions to turn them if there's more than one
+func sendPages(s *discordgo.Session, channelID string, pages []*discordgo.MessageEmbed) (*discordgo.Message, error) {
+	return sendPagesFrom(s, channelID, pages, 0)
+}
+
+// sendPagesFrom is sendPages opening on the given page rather than the first
+func sendPagesFrom(s *discordgo.Session, channelID string, pages []*discordgo.MessageEmbed, current int) (*discordgo.Message, error) {
+	if len(pages) > 1 {
+		for n, page := range pages {
+			footer := "Page " + strconv.Itoa(n+1) + " of " + strconv.Itoa(len(pages))
+			if page.Footer != nil && page.Footer.Text != "" {
+				footer = page.Footer.Text + " • " + footer
+			}
+			page.Footer = &discordgo.MessageEmbedFooter{Text: footer}
+		}
+	}
+	msg, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{Embed: pages[current]})
+	if err != nil || len(pages) == 1 {
+		return msg, err
+	}
+
+	now := time.Now()
+	pagedMessages.Lock()
+	for id, paged := range pagedMessages.messages {
+		if now.After(paged.expires) {
+			delete(pagedMessages.messages, id)
+		}
+	}
+	pagedMessages.messages[msg.ID] = &pagedMessage{pages: pages, current: current, expires: now.Add(pagedMessageLifetime)}
+	pagedMessages.Unlock()
+
+	s.MessageReactionAdd(channelID, msg.ID, pagePrevious)
+	s.MessageReactionAdd(channelID, msg.ID, pageNext)
+	return msg, nil
+}
+
+// handlePageTurn turns a paged message when someone reacts to it
+func handlePageTurn(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	if r.UserID == s.State.User.ID || (r.Emoji.Name != pagePrevious && r.Emoji.Name != pageNext) {
+		return
+	}
+	pagedMessages.Lock()
+	paged, ok := pagedMessages.messages[r.MessageID]
+	if !ok || time.Now().After(paged.expires) {
+		pagedMessages.Unlock()
+		return
+	}
+	if r.Emoji.Name == pageNext {
+		paged.current = (paged.current + 1) % len(paged.pages)
+	} else {
+		paged.current = (paged.current + len(paged.pages) - 1) % len(paged.pages)
+	}
+	page := paged.pages[paged.current]
+	pagedMessages.Unlock()
+
+	if _, err := s.ChannelMessageEditEmbed(r.ChannelID, r.MessageID, page); err != nil {
+		log.Printf("Error turning a page: %v", err)
+	}
+	// Take their reaction off so they can press it again
+	s.MessageReactionRemove(r.ChannelID, r.MessageID, r.Emoji.Name, r.UserID)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/bwmarrin/discordgo"
+)
+
+// participantRoleName is what the role we ping for music months is called when we make it
+const participantRoleName = "Music Month"
+
+// participantDocID keys sign-ups for a month in musicparticipants
+func participantDocID(guildID, monthName, userID string) string {
+	return guildID + "_" + monthName + "_" + userID
+}
+
+// joinableMonth is the month people are signing up to: the one running now, or failing that the next one planned
+func joinableMonth(now time.Time) (*month, bool) {
+	if m, ok := findMusicMonth(now); ok && m.name() == now.Format(musicMonthFormat) {
+		return m, true
+	}
+	docs, err := firestoreClient.Collection("musicmonth").Where("StartTime", ">", now.UTC()).OrderBy("StartTime", firestore.Asc).Limit(1).Documents(ctx).GetAll()
+	if err != nil || len(docs) == 0 {
+		return nil, false
+	}
+	var m month
+	if err := docs[0].DataTo(&m); err != nil {
+		return nil, false
+	}
+	return &m, true
+}
+
+// participantRoleLock stops members joining at the same time from each making a role
+var participantRoleLock sync.Mutex
+
+// participantRole returns the guild's music month role, making it if it doesn't have one yet or it's been deleted
+func participantRole(s *discordgo.Session, guildID string) (string, error) {
+	participantRoleLock.Lock()
+	defer participantRoleLock.Unlock()
+	config := loadMusicConfig(guildID)
+	if config.ParticipantRole != "" {
+		roles, err := s.GuildRoles(guildID)
+		if err != nil {
+			return "", err
+		}
+		for _, role := range roles {
+			if role.ID == config.ParticipantRole {
+				return role.ID, nil
+			}
+		}
+	}
+	role, err := s.GuildRoleCreate(guildID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.GuildRoleEdit(guildID, role.ID, participantRoleName, 0, false, 0, true); err != nil {
+		s.GuildRoleDelete(guildID, role.ID)
+		return "", err
+	}
+	// Only touch the role, so we don't undo any /musicconfig changes made since we loaded the config
+	_, err = firestoreClient.Collection("musicconfig").Doc(guildID).Set(ctx, map[string]interface{}{
+		"participantRole": role.ID,
+	}, firestore.MergeAll)
+	if err != nil {
+		return "", err
+	}
+	return role.ID, nil
+}
+
+func handleMusicJoin(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if firestoreClient == nil {
+		// We're not connected to GCP, don't let them do this
+		respond(s, i, "I haven't been set up to allow music months, please moan at whoever set me up")
+		return
+	}
+	m, ok := joinableMonth(time.Now())
+	if !ok {
+		respondPrivately(s, i, "No music month planned")
+		return
+	}
+	ref := firestoreClient.Collection("musicparticipants").Doc(participantDocID(i.GuildID, m.name(), i.Member.User.ID))
+
+	if boolOption(options(i.Data.Options), "leave") {
+		if _, err := ref.Delete(ctx); err != nil {
+			log.Printf("Error deleting record from Firestore: %v", err)
+		}
+		if roleID := loadMusicConfig(i.GuildID).ParticipantRole; roleID != "" {
+			s.GuildMemberRoleRemove(i.GuildID, i.Member.User.ID, roleID)
+		}
+		respondPrivately(s, i, "You've left "+m.StartTime.Format("January")+"'s music month, so you won't be pinged for it any more")
+		return
+	}
+
+	roleID, err := participantRole(s, i.GuildID)
+	if err != nil {
+		log.Printf("Error making the music month role: %v", err)
+		respondPrivately(s, i, "I couldn't make a "+participantRoleName+" role - I need the Manage Roles permission")
+		return
+	}
+	// Sign them up before handing out the role, so checkMusicRoles always knows to take it back off them
+	_, err = ref.Set(ctx, map[string]interface{}{
+		"guildID":  i.GuildID,
+		"month":    m.name(),
+		"userID":   i.Member.User.ID,
+		"joinedAt": time.Now(),
+		"roleEnds": loadMusicConfig(i.GuildID).monthEnd(m),
+	})
+	if err != nil {
+		log.Printf("Error saving record to Firestore: %v", err)
+		respondPrivately(s, i, "Something went wrong at my end so I couldn't sign you up")
+		return
+	}
+	if err := s.GuildMemberRoleAdd(i.GuildID, i.Member.User.ID, roleID); err != nil {
+		log.Printf("Error giving out the music month role: %v", err)
+		if _, err := ref.Delete(ctx); err != nil {
+			log.Printf("Error deleting record from Firestore: %v", err)
+		}
+		respondPrivately(s, i, "I couldn't give you the "+participantRoleName+" role - it needs to be below mine in the role list")
+		return
+	}
+	respond(s, i, i.Member.User.Username+" has signed up for "+m.StartTime.Format("January")+"'s music month! Use /musicjoin to join in and get pinged for the prompts too")
+}
+
+// checkMusicRoles takes the music month role back off members once the month they signed up for is over, unless
+// they've already signed up for the next one
+func checkMusicRoles() {
+	now := time.Now()
+	docs, err := firestoreClient.Collection("musicparticipants").Where("roleEnds", "<=", now).Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("Error getting finished music month participants: %v", err)
+		return
+	}
+	for _, doc := range docs {
+		var joined struct {
+			GuildID string `firestore:"guildID"`
+			UserID  string `firestore:"userID"`
+		}
+		if err := doc.DataTo(&joined); err != nil {
+			log.Printf("Error reading a music month participant: %v", err)
+			continue
+		}
+		others, _ := firestoreClient.Collection("musicparticipants").Where("guildID", "==", joined.GuildID).Where("userID", "==", joined.UserID).Documents(ctx).GetAll()
+		stillIn := false
+		for _, other := range others {
+			if ends, ok := other.Data()["roleEnds"].(time.Time); ok && ends.After(now) {
+				stillIn = true
+			}
+		}
+		roleID := loadMusicConfig(joined.GuildID).ParticipantRole
+		if !stillIn && roleID != "" {
+			// They may have left the server or had it taken off already, neither of which is worth stopping for
+			if err := session.GuildMemberRoleRemove(joined.GuildID, joined.UserID, roleID); err != nil {
+				log.Printf("Error taking the music month role off %v: %v", joined.UserID, err)
+			}
+		}
+		// Keep the sign-up for the record, but stop it coming up again
+		doc.Ref.Update(ctx, []firestore.Update{{Path: "roleEnds", Value: firestore.Delete}})
+	}
+}
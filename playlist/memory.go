@@ -0,0 +1,225 @@
+package playlist
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// ErrNoPlaylist is returned by Memory for playlists it doesn't have
+var ErrNoPlaylist = errors.New("no such playlist")
+
+// Memory is an in-memory Provider that behaves like YouTube, for exercising playlist logic without the real thing
+type Memory struct {
+	// ProviderName is what Name returns, defaulting to "youtube"
+	ProviderName string
+	// PageSize is how many items Items returns at a time, defaulting to 50 like YouTube
+	PageSize int
+	// Tracks maps song titles to track IDs for Match
+	Tracks map[string]string
+	// Fail, if set, is called before every call with the method's name and can return an error to fail it
+	Fail func(method string) error
+
+	mu        sync.Mutex
+	nextID    int
+	playlists map[string]*memoryPlaylist
+}
+
+type memoryPlaylist struct {
+	details Details
+	items   []Item
+}
+
+func (m *Memory) Name() string {
+	if m.ProviderName == "" {
+		return "youtube"
+	}
+	return m.ProviderName
+}
+
+func (m *Memory) fail(method string) error {
+	if m.Fail == nil {
+		return nil
+	}
+	return m.Fail(method)
+}
+
+func (m *Memory) newID(prefix string) string {
+	m.nextID++
+	return prefix + strconv.Itoa(m.nextID)
+}
+
+func (m *Memory) CreatePlaylist(details Details) (string, error) {
+	if err := m.fail("CreatePlaylist"); err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.playlists == nil {
+		m.playlists = map[string]*memoryPlaylist{}
+	}
+	id := m.newID("PL")
+	m.playlists[id] = &memoryPlaylist{details: details}
+	return id, nil
+}
+
+func (m *Memory) UpdatePlaylist(playlistID string, details Details) error {
+	if err := m.fail("UpdatePlaylist"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pl, ok := m.playlists[playlistID]
+	if !ok {
+		return ErrNoPlaylist
+	}
+	pl.details = details
+	return nil
+}
+
+func (m *Memory) Items(playlistID, pageToken string) ([]Item, string, error) {
+	if err := m.fail("Items"); err != nil {
+		return nil, "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pl, ok := m.playlists[playlistID]
+	if !ok {
+		return nil, "", ErrNoPlaylist
+	}
+	pageSize := m.PageSize
+	if pageSize <= 0 {
+		pageSize = 50
+	}
+	start := 0
+	if pageToken != "" {
+		var err error
+		if start, err = strconv.Atoi(pageToken); err != nil {
+			return nil, "", errors.New("bad page token")
+		}
+	}
+	end := start + pageSize
+	next := strconv.Itoa(end)
+	if end >= len(pl.items) {
+		end = len(pl.items)
+		next = ""
+	}
+	if start > end {
+		start = end
+	}
+	return append([]Item(nil), pl.items[start:end]...), next, nil
+}
+
+func (m *Memory) Add(playlistID, trackID string, position int) (Item, error) {
+	if err := m.fail("Add"); err != nil {
+		return Item{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pl, ok := m.playlists[playlistID]
+	if !ok {
+		return Item{}, ErrNoPlaylist
+	}
+	if position < 0 || position > len(pl.items) {
+		position = len(pl.items)
+	}
+	item := Item{ID: m.newID("PLI"), TrackID: trackID, Position: position}
+	pl.items = insertItem(pl.items, item, position)
+	return item, nil
+}
+
+func (m *Memory) Move(playlistID string, item Item, from, to int) error {
+	if err := m.fail("Move"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pl, ok := m.playlists[playlistID]
+	if !ok {
+		return ErrNoPlaylist
+	}
+	if from < 0 || from >= len(pl.items) || to < 0 || to >= len(pl.items) || pl.items[from].ID != item.ID {
+		return errors.New("bad move")
+	}
+	moving := pl.items[from]
+	pl.items = insertItem(append(pl.items[:from], pl.items[from+1:]...), moving, to)
+	return nil
+}
+
+func (m *Memory) Remove(playlistID string, item Item) error {
+	if err := m.fail("Remove"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pl, ok := m.playlists[playlistID]
+	if !ok {
+		return ErrNoPlaylist
+	}
+	for n, existing := range pl.items {
+		if existing.ID == item.ID {
+			pl.items = append(pl.items[:n], pl.items[n+1:]...)
+			return nil
+		}
+	}
+	return errors.New("no such playlist item")
+}
+
+func (m *Memory) SetNote(playlistID string, item Item, note string) error {
+	if err := m.fail("SetNote"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pl, ok := m.playlists[playlistID]
+	if !ok {
+		return ErrNoPlaylist
+	}
+	for n, existing := range pl.items {
+		if existing.ID == item.ID {
+			pl.items[n].Note = note
+			return nil
+		}
+	}
+	return errors.New("no such playlist item")
+}
+
+func (m *Memory) Match(song Song) (string, error) {
+	if err := m.fail("Match"); err != nil {
+		return "", err
+	}
+	if trackID, ok := m.Tracks[song.Title]; ok {
+		return trackID, nil
+	}
+	return "", ErrNoMatch
+}
+
+func (m *Memory) URL(playlistID string) string {
+	return "memory://" + playlistID
+}
+
+// TrackIDs lists the track IDs on a playlist in order
+func (m *Memory) TrackIDs(playlistID string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pl, ok := m.playlists[playlistID]
+	if !ok {
+		return nil
+	}
+	var trackIDs []string
+	for _, item := range pl.items {
+		trackIDs = append(trackIDs, item.TrackID)
+	}
+	return trackIDs
+}
+
+// Details returns a playlist's details
+func (m *Memory) Details(playlistID string) (Details, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pl, ok := m.playlists[playlistID]
+	if !ok {
+		return Details{}, false
+	}
+	return pl.details, true
+}
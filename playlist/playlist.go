@@ -0,0 +1,273 @@
+// Package playlist builds playlists of music month picks on streaming services.
+package playlist
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Item is an entry on a provider's playlist
+type Item struct {
+	// ID identifies the entry itself, which is what providers remove by. It's empty for entries that can't be played or
+	// changed, such as tracks pulled from Spotify, which are still listed so everything after them keeps its position
+	ID string
+	// TrackID is the song the entry plays
+	TrackID string
+	// Position is where the entry sat on the playlist when it was listed
+	Position int
+	// Note is the entry's note, for providers that have them
+	Note string
+}
+
+// Song is what we know about a pick when looking for it on another provider
+type Song struct {
+	Title  string
+	Artist string
+}
+
+var (
+	// ErrNoMatch is returned by Match when a provider has nothing resembling the song
+	ErrNoMatch = errors.New("no matching track")
+	// ErrNotConfigured is returned when a provider was never connected to its service
+	ErrNotConfigured = errors.New("playlist provider isn't connected")
+)
+
+// videoNoise is the bracketed clutter on video titles, eg (Official Video) or [HD]
+var videoNoise = regexp.MustCompile(`\s*[(\[][^)\]]*[)\]]`)
+
+// searchQuery turns a song into something a provider's search will understand
+func searchQuery(song Song) string {
+	title := strings.TrimSpace(videoNoise.ReplaceAllString(song.Title, ""))
+	// Music videos are usually titled "Artist - Song" already, and the channel is more likely to be a label than the artist
+	if strings.Contains(title, " - ") || song.Artist == "" {
+		return title
+	}
+	return song.Artist + " " + title
+}
+
+// Who can see a playlist
+const (
+	Public   = "public"
+	Unlisted = "unlisted"
+	Private  = "private"
+)
+
+// Details are what a playlist's called and who can see it
+type Details struct {
+	Title       string
+	Description string
+	// Privacy is Public, Unlisted or Private. Providers without unlisted playlists keep them off people's profiles instead
+	Privacy string
+}
+
+// Provider is a streaming service we can keep playlists on
+type Provider interface {
+	// Name is the links.Provider whose IDs this provider's tracks use
+	Name() string
+	// CreatePlaylist makes a new playlist and returns its ID
+	CreatePlaylist(details Details) (string, error)
+	// UpdatePlaylist changes an existing playlist's details
+	UpdatePlaylist(playlistID string, details Details) error
+	// Items lists a page of a playlist, returning the token for the next page or "" on the last one
+	Items(playlistID, pageToken string) ([]Item, string, error)
+	// Add puts a track on a playlist at the given position, returning the new entry
+	Add(playlistID, trackID string, position int) (Item, error)
+	// Move shifts an entry from one position on a playlist to another
+	Move(playlistID string, item Item, from, to int) error
+	// Remove takes an entry off a playlist
+	Remove(playlistID string, item Item) error
+	// Match finds the provider's track for a song posted from somewhere else
+	Match(song Song) (string, error)
+	// URL is where people can listen to a playlist
+	URL(playlistID string) string
+}
+
+// Noter is a Provider that can put a note on each playlist entry
+type Noter interface {
+	// SetNote changes an entry's note
+	SetNote(playlistID string, item Item, note string) error
+}
+
+// Annotate sets the notes on a playlist's entries, keyed by track ID, returning how many it changed. Entries whose notes
+// are already right are left alone, as are providers without notes
+func Annotate(p Provider, playlistID string, notes map[string]string) (int, error) {
+	noter, ok := p.(Noter)
+	if !ok {
+		return 0, nil
+	}
+	items, err := AllItems(p, playlistID)
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	for _, item := range items {
+		note, ok := notes[item.TrackID]
+		if !ok || note == item.Note || item.ID == "" {
+			continue
+		}
+		if err := noter.SetNote(playlistID, item, note); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// AllItems lists everything on a playlist, page by page
+func AllItems(p Provider, playlistID string) ([]Item, error) {
+	var items []Item
+	pageToken := ""
+	for {
+		page, next, err := p.Items(playlistID, pageToken)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page {
+			item.Position = len(items)
+			items = append(items, item)
+		}
+		if next == "" {
+			return items, nil
+		}
+		pageToken = next
+	}
+}
+
+// SyncResult says what Sync changed, and what it couldn't
+type SyncResult struct {
+	Added   int
+	Removed int
+	Moved   int
+	// Failed holds an error for every change that didn't go through
+	Failed []error
+}
+
+// Err summarises any failures, or returns nil if everything went through
+func (r SyncResult) Err() error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d changes failed, first: %w", len(r.Failed), r.Failed[0])
+}
+
+// Sync makes a playlist hold exactly the given tracks in the given order. A track listed more than once only goes on the
+// playlist the first time. Sync carries on past failed changes so one bad song doesn't leave the playlist half done;
+// they're reported in the result, and running Sync again picks up where it left off. Running out of quota is the
+// exception: Sync stops there and returns the QuotaError, as nothing else is going to get through either
+func Sync(p Provider, playlistID string, trackIDs []string) (SyncResult, error) {
+	var result SyncResult
+	items, err := AllItems(p, playlistID)
+	if err != nil {
+		return result, err
+	}
+
+	var want []string
+	wanted := map[string]bool{}
+	for _, trackID := range trackIDs {
+		if !wanted[trackID] {
+			wanted[trackID] = true
+			want = append(want, trackID)
+		}
+	}
+
+	// Take off anything we don't want, and second copies of things we do. Going backwards keeps the
+	// positions of entries we've yet to remove accurate
+	kept := map[string]bool{}
+	var removals []Item
+	var current []Item
+	stuck := map[Item]bool{}
+	for _, item := range items {
+		if item.ID == "" {
+			// There's nothing we can do with it, so work around it
+			stuck[item] = true
+			current = append(current, item)
+			continue
+		}
+		if wanted[item.TrackID] && !kept[item.TrackID] {
+			kept[item.TrackID] = true
+			current = append(current, item)
+		} else {
+			removals = append(removals, item)
+		}
+	}
+	for n := len(removals) - 1; n >= 0; n-- {
+		if err := p.Remove(playlistID, removals[n]); err != nil {
+			result.Failed = append(result.Failed, fmt.Errorf("removing %v: %w", removals[n].TrackID, err))
+			if isQuotaError(err) {
+				return result, result.Failed[len(result.Failed)-1]
+			}
+			// It's still there, so keep our idea of positions right
+			stuck[removals[n]] = true
+			current = insertItem(current, removals[n], removalIndex(current, removals[n]))
+			continue
+		}
+		result.Removed++
+	}
+
+	// Then walk the wanted order, moving or adding whatever isn't already in place
+	pos := 0
+	for _, trackID := range want {
+		for pos < len(current) && stuck[current[pos]] {
+			pos++
+		}
+		idx := -1
+		for n := pos; n < len(current); n++ {
+			if current[n].TrackID == trackID && !stuck[current[n]] {
+				idx = n
+				break
+			}
+		}
+		switch {
+		case idx == pos:
+		case idx > pos:
+			if err := p.Move(playlistID, current[idx], idx, pos); err != nil {
+				result.Failed = append(result.Failed, fmt.Errorf("moving %v: %w", trackID, err))
+				if isQuotaError(err) {
+					return result, result.Failed[len(result.Failed)-1]
+				}
+				continue
+			}
+			item := current[idx]
+			current = insertItem(append(current[:idx], current[idx+1:]...), item, pos)
+			result.Moved++
+		default:
+			item, err := p.Add(playlistID, trackID, pos)
+			if err != nil {
+				result.Failed = append(result.Failed, fmt.Errorf("adding %v: %w", trackID, err))
+				if isQuotaError(err) {
+					return result, result.Failed[len(result.Failed)-1]
+				}
+				continue
+			}
+			current = insertItem(current, item, pos)
+			result.Added++
+		}
+		pos++
+	}
+	return result, result.Err()
+}
+
+// isQuotaError reports whether err means a provider won't take any more calls for now
+func isQuotaError(err error) bool {
+	var quotaErr *QuotaError
+	return errors.As(err, &quotaErr)
+}
+
+func insertItem(items []Item, item Item, pos int) []Item {
+	items = append(items, Item{})
+	copy(items[pos+1:], items[pos:])
+	items[pos] = item
+	return items
+}
+
+// removalIndex finds where an entry we failed to remove sits among the entries we're keeping
+func removalIndex(current []Item, item Item) int {
+	for n, kept := range current {
+		if kept.Position > item.Position {
+			return n
+		}
+	}
+	return len(current)
+}
@@ -0,0 +1,237 @@
+package playlist
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// newMemoryPlaylist makes a playlist on m holding the given tracks in order
+func newMemoryPlaylist(t *testing.T, m *Memory, trackIDs ...string) string {
+	t.Helper()
+	id, err := m.CreatePlaylist(Details{Title: "Music month"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, trackID := range trackIDs {
+		if _, err := m.Add(id, trackID, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return id
+}
+
+func TestAllItems(t *testing.T) {
+	m := &Memory{PageSize: 2}
+	id := newMemoryPlaylist(t, m, "a", "b", "c", "d", "e")
+	items, err := AllItems(m, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := trackIDsOf(items), []string{"a", "b", "c", "d", "e"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("tracks = %v, want %v", got, want)
+	}
+	for n, item := range items {
+		if item.Position != n {
+			t.Errorf("%v is at position %d, want %d", item.TrackID, item.Position, n)
+		}
+	}
+
+	if _, err := AllItems(m, "nope"); err != ErrNoPlaylist {
+		t.Errorf("listing a missing playlist = %v, want ErrNoPlaylist", err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	tests := []struct {
+		name  string
+		start []string
+		want  []string
+		// result is what Sync should report doing
+		result SyncResult
+	}{
+		{name: "empty", want: []string{"a", "b", "c"}, result: SyncResult{Added: 3}},
+		{name: "add to the end", start: []string{"a", "b"}, want: []string{"a", "b", "c"}, result: SyncResult{Added: 1}},
+		{name: "add in the middle", start: []string{"a", "c"}, want: []string{"a", "b", "c"}, result: SyncResult{Added: 1}},
+		{name: "remove", start: []string{"a", "b", "c"}, want: []string{"a", "c"}, result: SyncResult{Removed: 1}},
+		{name: "remove everything", start: []string{"a", "b", "c"}, result: SyncResult{Removed: 3}},
+		{name: "reorder", start: []string{"c", "b", "a"}, want: []string{"a", "b", "c"}, result: SyncResult{Moved: 2}},
+		{name: "already right", start: []string{"a", "b", "c"}, want: []string{"a", "b", "c"}},
+		{name: "duplicates on the playlist", start: []string{"a", "a", "b"}, want: []string{"a", "b"}, result: SyncResult{Removed: 1}},
+		{name: "duplicates wanted", start: []string{"a"}, want: []string{"a", "b", "a"}, result: SyncResult{Added: 1}},
+		{name: "everything at once", start: []string{"x", "c", "a", "y", "b"}, want: []string{"a", "b", "d", "c"}, result: SyncResult{Added: 1, Removed: 2, Moved: 2}},
+	}
+	for _, test := range tests {
+		m := &Memory{PageSize: 2}
+		id := newMemoryPlaylist(t, m, test.start...)
+		result, err := Sync(m, id, test.want)
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		want := map[string]bool{}
+		var deduped []string
+		for _, trackID := range test.want {
+			if !want[trackID] {
+				want[trackID] = true
+				deduped = append(deduped, trackID)
+			}
+		}
+		if got := m.TrackIDs(id); !reflect.DeepEqual(got, deduped) {
+			t.Errorf("%v: tracks = %v, want %v", test.name, got, deduped)
+		}
+		if !reflect.DeepEqual(result, test.result) {
+			t.Errorf("%v: result = %+v, want %+v", test.name, result, test.result)
+		}
+	}
+}
+
+func TestSyncCarriesOnPastFailures(t *testing.T) {
+	adds := 0
+	m := &Memory{PageSize: 2}
+	m.Fail = func(method string) error {
+		if method != "Add" {
+			return nil
+		}
+		adds++
+		if adds == 2 {
+			return errors.New("that one's blocked")
+		}
+		return nil
+	}
+	id := newMemoryPlaylist(t, m)
+
+	result, err := Sync(m, id, []string{"a", "b", "c", "d"})
+	if err == nil || len(result.Failed) != 1 || result.Added != 3 {
+		t.Fatalf("result = %+v, %v, want 3 added and 1 failure", result, err)
+	}
+	if got, want := m.TrackIDs(id), []string{"a", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tracks = %v, want %v", got, want)
+	}
+
+	// The next run picks up the one that failed
+	m.Fail = nil
+	result, err = Sync(m, id, []string{"a", "b", "c", "d"})
+	if err != nil || result.Added != 1 {
+		t.Fatalf("second run = %+v, %v, want 1 added", result, err)
+	}
+	if got, want := m.TrackIDs(id), []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tracks = %v, want %v", got, want)
+	}
+}
+
+// failNth fails the nth call to method, counting from 1
+func failNth(method string, nth int, err error) func(string) error {
+	calls := 0
+	return func(called string) error {
+		if called != method {
+			return nil
+		}
+		calls++
+		if calls == nth {
+			return err
+		}
+		return nil
+	}
+}
+
+func TestSyncOrderAfterRemovals(t *testing.T) {
+	tests := []struct {
+		name  string
+		start []string
+		want  []string
+		// failRemove is which removal to fail, counting from the end of the playlist as Sync removes backwards
+		failRemove int
+		tracks     []string
+		result     SyncResult
+	}{
+		{name: "removals before", start: []string{"x", "y", "a", "b"}, want: []string{"a", "b"}, tracks: []string{"a", "b"}, result: SyncResult{Removed: 2}},
+		{name: "removals between", start: []string{"a", "x", "b", "y", "c"}, want: []string{"c", "b", "a"}, tracks: []string{"c", "b", "a"}, result: SyncResult{Removed: 2, Moved: 2}},
+		{name: "stuck at the end", start: []string{"a", "x", "b", "y"}, want: []string{"b", "a"}, failRemove: 1, tracks: []string{"b", "a", "y"}, result: SyncResult{Removed: 1, Moved: 1}},
+		{name: "stuck at the start", start: []string{"x", "a", "y", "b"}, want: []string{"b", "a"}, failRemove: 2, tracks: []string{"x", "b", "a"}, result: SyncResult{Removed: 1, Moved: 1}},
+		{name: "stuck in the middle", start: []string{"a", "x", "b"}, want: []string{"b", "c", "a"}, failRemove: 1, tracks: []string{"b", "c", "a", "x"}, result: SyncResult{Added: 1, Moved: 1}},
+	}
+	for _, test := range tests {
+		m := &Memory{PageSize: 2}
+		id := newMemoryPlaylist(t, m, test.start...)
+		if test.failRemove > 0 {
+			m.Fail = failNth("Remove", test.failRemove, errors.New("can't remove that"))
+		}
+		result, err := Sync(m, id, test.want)
+		if got := m.TrackIDs(id); !reflect.DeepEqual(got, test.tracks) {
+			t.Errorf("%v: tracks = %v, want %v", test.name, got, test.tracks)
+		}
+		if test.failRemove > 0 {
+			if err == nil || len(result.Failed) != 1 {
+				t.Errorf("%v: failures = %v, %v, want the one removal", test.name, result.Failed, err)
+			}
+			result.Failed = nil
+		} else if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(result, test.result) {
+			t.Errorf("%v: result = %+v, want %+v", test.name, result, test.result)
+		}
+	}
+}
+
+func TestSyncStopsOnQuotaError(t *testing.T) {
+	tests := []struct {
+		name   string
+		start  []string
+		method string
+		nth    int
+		// tracks is what's on the playlist when Sync stops
+		tracks []string
+		result SyncResult
+	}{
+		{name: "adding", method: "Add", nth: 3, tracks: []string{"a", "b"}, result: SyncResult{Added: 2}},
+		{name: "removing", start: []string{"a", "x", "b", "y", "c", "z"}, method: "Remove", nth: 2, tracks: []string{"a", "x", "b", "y", "c"}, result: SyncResult{Removed: 1}},
+		{name: "moving", start: []string{"d", "c", "b", "a"}, method: "Move", nth: 2, tracks: []string{"a", "d", "c", "b"}, result: SyncResult{Moved: 1}},
+	}
+	want := []string{"a", "b", "c", "d"}
+	for _, test := range tests {
+		m := &Memory{PageSize: 2}
+		id := newMemoryPlaylist(t, m, test.start...)
+		calls := 0
+		fail := failNth(test.method, test.nth, &QuotaError{Err: errors.New("out of quota")})
+		stopped := false
+		m.Fail = func(method string) error {
+			if stopped {
+				calls++
+			}
+			err := fail(method)
+			if err != nil {
+				stopped = true
+			}
+			return err
+		}
+
+		result, err := Sync(m, id, want)
+		if !isQuotaError(err) {
+			t.Errorf("%v: err = %v, want a QuotaError", test.name, err)
+		}
+		if calls != 0 {
+			t.Errorf("%v: made %d more calls after running out of quota", test.name, calls)
+		}
+		if got := m.TrackIDs(id); !reflect.DeepEqual(got, test.tracks) {
+			t.Errorf("%v: tracks = %v, want %v", test.name, got, test.tracks)
+		}
+		if len(result.Failed) != 1 {
+			t.Errorf("%v: failures = %v, want just the quota error", test.name, result.Failed)
+		}
+		result.Failed = nil
+		if !reflect.DeepEqual(result, test.result) {
+			t.Errorf("%v: result = %+v, want %+v", test.name, result, test.result)
+		}
+
+		// Once the quota's back, the next run finishes the job
+		m.Fail = nil
+		if _, err := Sync(m, id, want); err != nil {
+			t.Errorf("%v: second run: %v", test.name, err)
+		}
+		if got := m.TrackIDs(id); !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: after the second run, tracks = %v, want %v", test.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package playlist
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// What YouTube Data API calls cost in quota units
+const (
+	QuotaRead   = 1
+	QuotaWrite  = 50
+	QuotaSearch = 100
+)
+
+// DefaultQuota is the daily quota YouTube gives a project unless you ask for more
+const DefaultQuota = 10000
+
+// QuotaError is returned when a provider won't take any more requests for a while. Nothing will work until RetryAt
+type QuotaError struct {
+	RetryAt time.Time
+	Err     error
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("out of quota until %v: %v", e.RetryAt.Format(time.RFC3339), e.Err)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return e.Err
+}
+
+// pacific is where YouTube's quota day runs; it resets at midnight there
+var pacific = func() *time.Location {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		// Good enough outside of daylight saving if the zone database is missing
+		return time.FixedZone("PST", -8*60*60)
+	}
+	return loc
+}()
+
+// Quota keeps an estimate of how much of the day's API quota we've spent, so we can stop before YouTube stops us.
+// It's only an estimate - other things sharing the project and restarts aren't counted - so YouTube's own
+// quotaExceeded errors are the final word and mark the day as spent
+type Quota struct {
+	// Limit is the project's daily quota, defaulting to DefaultQuota
+	Limit int
+
+	mu        sync.Mutex
+	day       string
+	used      int
+	exhausted bool
+}
+
+// rollover starts a fresh day's count when the quota has reset. Must be called with mu held
+func (q *Quota) rollover(now time.Time) {
+	day := now.In(pacific).Format("2006-01-02")
+	if day != q.day {
+		q.day = day
+		q.used = 0
+		q.exhausted = false
+	}
+}
+
+func (q *Quota) limit() int {
+	if q.Limit == 0 {
+		return DefaultQuota
+	}
+	return q.Limit
+}
+
+// Spend books units against today's quota, or returns a QuotaError if that would take us over
+func (q *Quota) Spend(units int) error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	q.rollover(now)
+	if q.exhausted || q.used+units > q.limit() {
+		return &QuotaError{RetryAt: ResetTime(now), Err: fmt.Errorf("used about %d of %d units today", q.used, q.limit())}
+	}
+	q.used += units
+	return nil
+}
+
+// Exhaust marks today's quota as spent, whatever our estimate says
+func (q *Quota) Exhaust() {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover(time.Now())
+	q.exhausted = true
+	q.used = q.limit()
+}
+
+// Used is roughly how many units we've spent today
+func (q *Quota) Used() int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover(time.Now())
+	return q.used
+}
+
+// ResetTime is when the quota day after t begins
+func ResetTime(t time.Time) time.Time {
+	local := t.In(pacific)
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, pacific)
+}
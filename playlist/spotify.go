@@ -0,0 +1,221 @@
+package playlist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mfcrocker/kazooiebot/links"
+)
+
+// SpotifyAPI is where the Spotify Web API lives
+const SpotifyAPI = "https://api.spotify.com/v1"
+
+// Spotify keeps playlists on Spotify. Client must carry a user token with the playlist-modify scopes
+type Spotify struct {
+	Client *http.Client
+	// BaseURL overrides SpotifyAPI, eg to point at a stand-in server
+	BaseURL string
+}
+
+// SpotifyError is an error response from the Spotify Web API
+type SpotifyError struct {
+	Status  int
+	Message string
+}
+
+func (e *SpotifyError) Error() string {
+	return fmt.Sprintf("spotify: %d %v", e.Status, e.Message)
+}
+
+func (s *Spotify) Name() string {
+	return string(links.Spotify)
+}
+
+func (s *Spotify) endpoint(path string) string {
+	base := s.BaseURL
+	if base == "" {
+		base = SpotifyAPI
+	}
+	if strings.HasPrefix(path, "http") {
+		// Paging links are already absolute
+		return path
+	}
+	return base + path
+}
+
+// do sends a request to the API, decoding any JSON response into out
+func (s *Spotify) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, s.endpoint(path), reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		err := &SpotifyError{Status: resp.StatusCode, Message: apiErr.Error.Message}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			// Spotify says how long to back off for in seconds
+			wait, convErr := strconv.Atoi(resp.Header.Get("Retry-After"))
+			if convErr != nil || wait <= 0 {
+				wait = 60
+			}
+			return &QuotaError{RetryAt: time.Now().Add(time.Duration(wait) * time.Second), Err: err}
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func trackURI(trackID string) string {
+	return "spotify:track:" + trackID
+}
+
+// spotifyPlaylist turns details into what Spotify expects. Spotify has no unlisted playlists, but anyone with the link
+// can open one that's not public, so unlisted ones just stay off the profile
+func spotifyPlaylist(details Details) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        details.Title,
+		"description": details.Description,
+		"public":      details.Privacy == Public,
+	}
+}
+
+func (s *Spotify) CreatePlaylist(details Details) (string, error) {
+	var created struct {
+		ID string `json:"id"`
+	}
+	err := s.do("POST", "/me/playlists", spotifyPlaylist(details), &created)
+	return created.ID, err
+}
+
+func (s *Spotify) UpdatePlaylist(playlistID string, details Details) error {
+	return s.do("PUT", "/playlists/"+url.PathEscape(playlistID), spotifyPlaylist(details), nil)
+}
+
+// Items lists a page of a playlist. Spotify pages by URL, so that's what the page token is
+func (s *Spotify) Items(playlistID, pageToken string) ([]Item, string, error) {
+	if pageToken == "" {
+		pageToken = "/playlists/" + url.PathEscape(playlistID) + "/tracks?fields=" + url.QueryEscape("items(track(id,uri)),next") + "&limit=100"
+	}
+	var page struct {
+		Items []struct {
+			Track *struct {
+				ID  string `json:"id"`
+				URI string `json:"uri"`
+			} `json:"track"`
+		} `json:"items"`
+		Next string `json:"next"`
+	}
+	if err := s.do("GET", pageToken, nil, &page); err != nil {
+		return nil, "", err
+	}
+	var items []Item
+	for _, entry := range page.Items {
+		if entry.Track == nil {
+			// Tracks pulled from Spotify stay on playlists as empty entries. They still count towards the positions
+			// Spotify removes and moves by, so they're listed without an ID
+			items = append(items, Item{})
+			continue
+		}
+		items = append(items, Item{ID: entry.Track.URI, TrackID: entry.Track.ID})
+	}
+	return items, page.Next, nil
+}
+
+func (s *Spotify) Add(playlistID, trackID string, position int) (Item, error) {
+	err := s.do("POST", "/playlists/"+url.PathEscape(playlistID)+"/tracks", map[string]interface{}{
+		"uris":     []string{trackURI(trackID)},
+		"position": position,
+	}, nil)
+	return Item{ID: trackURI(trackID), TrackID: trackID, Position: position}, err
+}
+
+func (s *Spotify) Move(playlistID string, item Item, from, to int) error {
+	if to > from {
+		// Spotify inserts before the given position, counted before the move
+		to++
+	}
+	return s.do("PUT", "/playlists/"+url.PathEscape(playlistID)+"/tracks", map[string]interface{}{
+		"range_start":   from,
+		"insert_before": to,
+	}, nil)
+}
+
+// Remove takes a single entry off the playlist. Spotify entries only have the track's URI to identify them, so we
+// say which occurrence by position too
+func (s *Spotify) Remove(playlistID string, item Item) error {
+	return s.do("DELETE", "/playlists/"+url.PathEscape(playlistID)+"/tracks", map[string]interface{}{
+		"tracks": []map[string]interface{}{{"uri": item.ID, "positions": []int{item.Position}}},
+	}, nil)
+}
+
+func (s *Spotify) Match(song Song) (string, error) {
+	var results struct {
+		Tracks struct {
+			Items []struct {
+				ID string `json:"id"`
+			} `json:"items"`
+		} `json:"tracks"`
+	}
+	err := s.do("GET", "/search?type=track&limit=1&q="+url.QueryEscape(searchQuery(song)), nil, &results)
+	if err != nil {
+		return "", err
+	}
+	if len(results.Tracks.Items) == 0 {
+		return "", ErrNoMatch
+	}
+	return results.Tracks.Items[0].ID, nil
+}
+
+// Track looks up a Spotify track, so it can be matched on other providers
+func (s *Spotify) Track(trackID string) (Song, error) {
+	var track struct {
+		Name    string `json:"name"`
+		Artists []struct {
+			Name string `json:"name"`
+		} `json:"artists"`
+	}
+	if err := s.do("GET", "/tracks/"+url.PathEscape(trackID), nil, &track); err != nil {
+		return Song{}, err
+	}
+	song := Song{Title: track.Name}
+	if len(track.Artists) > 0 {
+		song.Artist = track.Artists[0].Name
+	}
+	return song, nil
+}
+
+func (s *Spotify) URL(playlistID string) string {
+	return "https://open.spotify.com/playlist/" + playlistID
+}
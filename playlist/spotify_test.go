@@ -0,0 +1,296 @@
+package playlist
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSpotify is a stand-in for the bits of the Spotify Web API we use, holding one user's playlists in memory
+type fakeSpotify struct {
+	t        *testing.T
+	url      string
+	pageSize int
+	// tracks maps search queries to the track they find
+	tracks map[string]string
+	// retryAfter, if set, makes every request fail with a 429 and this as its Retry-After header
+	retryAfter string
+
+	mu        sync.Mutex
+	playlists map[string][]string
+	details   map[string]map[string]interface{}
+	searches  []string
+}
+
+func newFakeSpotify(t *testing.T) (*fakeSpotify, *Spotify) {
+	t.Helper()
+	fake := &fakeSpotify{t: t, pageSize: 2, tracks: map[string]string{}, playlists: map[string][]string{}, details: map[string]map[string]interface{}{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	fake.url = server.URL
+	return fake, &Spotify{Client: server.Client(), BaseURL: server.URL}
+}
+
+func (f *fakeSpotify) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.retryAfter != "" {
+		w.Header().Set("Retry-After", f.retryAfter)
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"message": "slow down"}})
+		return
+	}
+
+	var body map[string]interface{}
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/me/playlists":
+		id := "pl" + strconv.Itoa(len(f.playlists)+1)
+		f.playlists[id] = nil
+		f.details[id] = body
+		json.NewEncoder(w).Encode(map[string]string{"id": id})
+	case r.URL.Path == "/search":
+		q := r.URL.Query().Get("q")
+		f.searches = append(f.searches, q)
+		var items []map[string]string
+		if id, ok := f.tracks[q]; ok {
+			items = append(items, map[string]string{"id": id})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"tracks": map[string]interface{}{"items": items}})
+	case len(parts) == 2 && parts[0] == "playlists" && r.Method == "PUT":
+		f.details[parts[1]] = body
+	case len(parts) == 3 && parts[0] == "playlists" && parts[2] == "tracks":
+		f.tracksEndpoint(w, r, parts[1], body)
+	default:
+		f.t.Errorf("unexpected request %v %v", r.Method, r.URL)
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeSpotify) tracksEndpoint(w http.ResponseWriter, r *http.Request, id string, body map[string]interface{}) {
+	tracks, ok := f.playlists[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		end := offset + f.pageSize
+		next := f.url + "/playlists/" + id + "/tracks?offset=" + strconv.Itoa(end)
+		if end >= len(tracks) {
+			end = len(tracks)
+			next = ""
+		}
+		var items []map[string]interface{}
+		for _, track := range tracks[offset:end] {
+			if track == "" {
+				// A track that's been pulled from Spotify
+				items = append(items, map[string]interface{}{"track": nil})
+				continue
+			}
+			items = append(items, map[string]interface{}{"track": map[string]string{"id": track, "uri": trackURI(track)}})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items, "next": next})
+	case "POST":
+		pos := int(body["position"].(float64))
+		for _, uri := range body["uris"].([]interface{}) {
+			track := strings.TrimPrefix(uri.(string), "spotify:track:")
+			tracks = append(tracks, "")
+			copy(tracks[pos+1:], tracks[pos:])
+			tracks[pos] = track
+			pos++
+		}
+	case "PUT":
+		from, before := int(body["range_start"].(float64)), int(body["insert_before"].(float64))
+		track := tracks[from]
+		tracks = append(tracks[:from:from], tracks[from+1:]...)
+		if before > from {
+			before--
+		}
+		tracks = append(tracks, "")
+		copy(tracks[before+1:], tracks[before:])
+		tracks[before] = track
+	case "DELETE":
+		for _, entry := range body["tracks"].([]interface{}) {
+			entry := entry.(map[string]interface{})
+			for _, p := range entry["positions"].([]interface{}) {
+				pos := int(p.(float64))
+				if trackURI(tracks[pos]) != entry["uri"] {
+					f.t.Errorf("removing %v from position %d, which holds %v", entry["uri"], pos, tracks[pos])
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				tracks = append(tracks[:pos:pos], tracks[pos+1:]...)
+			}
+		}
+	}
+	f.playlists[id] = tracks
+}
+
+func (f *fakeSpotify) trackIDs(id string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.playlists[id]...)
+}
+
+func TestSpotifyPlaylist(t *testing.T) {
+	fake, s := newFakeSpotify(t)
+	id, err := s.CreatePlaylist(Details{Title: "Music month", Description: "All the picks", Privacy: Unlisted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.details[id]; got["name"] != "Music month" || got["public"] != false {
+		t.Errorf("created with %v, want a private playlist called Music month", got)
+	}
+
+	for n, track := range []string{"b", "c", "d", "e", "f"} {
+		if _, err := s.Add(id, track, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Add(id, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	// Pages of two mean following next links twice
+	items, err := AllItems(s, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := trackIDsOf(items), []string{"a", "b", "c", "d", "e", "f"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("tracks = %v, want %v", got, want)
+	}
+
+	if err := s.Remove(id, items[2]); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.trackIDs(id), []string{"a", "b", "d", "e", "f"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after removing c, tracks = %v, want %v", got, want)
+	}
+
+	if err := s.UpdatePlaylist(id, Details{Title: "Renamed", Privacy: Public}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.details[id]; got["name"] != "Renamed" || got["public"] != true {
+		t.Errorf("updated to %v, want a public playlist called Renamed", got)
+	}
+}
+
+func TestSpotifyItemsKeepPulledTracksInPlace(t *testing.T) {
+	fake, s := newFakeSpotify(t)
+	fake.playlists["pl1"] = []string{"a", "", "b"}
+	items, err := AllItems(s, "pl1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Item{
+		{ID: trackURI("a"), TrackID: "a", Position: 0},
+		{Position: 1},
+		{ID: trackURI("b"), TrackID: "b", Position: 2},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("items = %+v, want %+v", items, want)
+	}
+}
+
+func TestSpotifySyncAroundPulledTracks(t *testing.T) {
+	tests := []struct {
+		start  []string
+		want   []string
+		tracks []string
+	}{
+		{start: []string{"a", "", "x", "b"}, want: []string{"a", "b"}, tracks: []string{"a", "", "b"}},
+		{start: []string{"", "b", "a"}, want: []string{"a", "b", "c"}, tracks: []string{"", "a", "b", "c"}},
+		{start: []string{"x", "", "", "y", "a"}, want: []string{"a"}, tracks: []string{"", "", "a"}},
+	}
+	for _, test := range tests {
+		fake, s := newFakeSpotify(t)
+		fake.playlists["pl1"] = test.start
+		if _, err := Sync(s, "pl1", test.want); err != nil {
+			t.Errorf("syncing %q: %v", test.start, err)
+		}
+		if got := fake.trackIDs("pl1"); !reflect.DeepEqual(got, test.tracks) {
+			t.Errorf("syncing %q: tracks = %q, want %q", test.start, got, test.tracks)
+		}
+	}
+}
+
+func TestSpotifySync(t *testing.T) {
+	fake, s := newFakeSpotify(t)
+	fake.playlists["pl1"] = []string{"x", "c", "a", "b", "x"}
+	result, err := Sync(s, "pl1", []string{"a", "b", "c", "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.trackIDs("pl1"), []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tracks = %v, want %v", got, want)
+	}
+	if result.Added != 1 || result.Removed != 2 {
+		t.Errorf("result = %+v, want 1 added and 2 removed", result)
+	}
+}
+
+func TestSpotifyRateLimit(t *testing.T) {
+	tests := []struct {
+		retryAfter string
+		want       time.Duration
+	}{
+		{retryAfter: "30", want: 30 * time.Second},
+		// Spotify should always say, but if it doesn't we wait a minute
+		{retryAfter: "soon", want: time.Minute},
+	}
+	for _, test := range tests {
+		fake, s := newFakeSpotify(t)
+		fake.retryAfter = test.retryAfter
+		start := time.Now()
+		_, err := s.CreatePlaylist(Details{Title: "Music month"})
+		var quotaErr *QuotaError
+		if !errors.As(err, &quotaErr) {
+			t.Fatalf("Retry-After %v: err = %v, want a QuotaError", test.retryAfter, err)
+		}
+		if wait := quotaErr.RetryAt.Sub(start); wait < test.want || wait > test.want+5*time.Second {
+			t.Errorf("Retry-After %v: retry in %v, want %v", test.retryAfter, wait, test.want)
+		}
+		var spotifyErr *SpotifyError
+		if !errors.As(err, &spotifyErr) || spotifyErr.Status != http.StatusTooManyRequests || spotifyErr.Message != "slow down" {
+			t.Errorf("Retry-After %v: err = %v, want the 429 underneath", test.retryAfter, err)
+		}
+	}
+}
+
+func TestSpotifyMatch(t *testing.T) {
+	fake, s := newFakeSpotify(t)
+	fake.tracks["Artist Song"] = "found"
+
+	id, err := s.Match(Song{Title: "Song (Official Video)", Artist: "Artist"})
+	if err != nil || id != "found" {
+		t.Errorf("Match = %v, %v, want found", id, err)
+	}
+	if _, err := s.Match(Song{Title: "Nothing Like It"}); err != ErrNoMatch {
+		t.Errorf("Match of an unknown song = %v, want ErrNoMatch", err)
+	}
+	if want := []string{"Artist Song", "Nothing Like It"}; !reflect.DeepEqual(fake.searches, want) {
+		t.Errorf("searched for %q, want %q", fake.searches, want)
+	}
+}
+
+func trackIDsOf(items []Item) []string {
+	var trackIDs []string
+	for _, item := range items {
+		if item.ID == "" {
+			continue
+		}
+		trackIDs = append(trackIDs, item.TrackID)
+	}
+	return trackIDs
+}
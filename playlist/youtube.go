@@ -0,0 +1,240 @@
+package playlist
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mfcrocker/kazooiebot/links"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/youtube/v3"
+)
+
+// YouTube keeps playlists on YouTube. A YouTube without a Service, eg because auth failed at startup, returns ErrNotConfigured
+type YouTube struct {
+	Service *youtube.Service
+	// Quota, if set, keeps track of what we've spent and refuses calls once the day's quota is gone
+	Quota *Quota
+}
+
+// rateLimitRetries is how many times we back off and retry a call YouTube says is coming too fast
+const rateLimitRetries = 3
+
+func (y *YouTube) call(cost int, do func() error) error {
+	if y.Service == nil {
+		return ErrNotConfigured
+	}
+	return CallYouTube(y.Quota, cost, do)
+}
+
+// CallYouTube spends cost units of quota on a call to the YouTube API, backing off if we're going too fast and turning
+// running out of quota into a QuotaError. quota can be nil
+func CallYouTube(quota *Quota, cost int, do func() error) error {
+	wait := time.Second
+	for attempt := 0; ; attempt++ {
+		if err := quota.Spend(cost); err != nil {
+			return err
+		}
+		err := do()
+		var apiErr *googleapi.Error
+		if !errors.As(err, &apiErr) {
+			return err
+		}
+		switch quotaReason(apiErr) {
+		case "quotaExceeded", "dailyLimitExceeded":
+			quota.Exhaust()
+			return &QuotaError{RetryAt: ResetTime(time.Now()), Err: err}
+		case "rateLimitExceeded", "userRateLimitExceeded":
+			if attempt == rateLimitRetries {
+				return &QuotaError{RetryAt: time.Now().Add(time.Minute), Err: err}
+			}
+			time.Sleep(wait)
+			wait *= 2
+		default:
+			return err
+		}
+	}
+}
+
+// quotaReason finds the reason YouTube gave for refusing a call on quota grounds, if it did
+func quotaReason(err *googleapi.Error) string {
+	for _, item := range err.Errors {
+		switch item.Reason {
+		case "quotaExceeded", "dailyLimitExceeded", "rateLimitExceeded", "userRateLimitExceeded":
+			return item.Reason
+		}
+	}
+	return ""
+}
+
+func (y *YouTube) Name() string {
+	return string(links.YouTube)
+}
+
+// The longest titles and descriptions YouTube will take
+const (
+	maxTitleLength       = 150
+	maxDescriptionLength = 5000
+)
+
+// youtubePlaylist turns details into what YouTube expects, defaulting to unlisted
+func youtubePlaylist(details Details) *youtube.Playlist {
+	privacy := details.Privacy
+	if privacy == "" {
+		privacy = Unlisted
+	}
+	return &youtube.Playlist{
+		Snippet: &youtube.PlaylistSnippet{
+			Title:       truncate(details.Title, maxTitleLength),
+			Description: truncate(details.Description, maxDescriptionLength),
+		},
+		Status: &youtube.PlaylistStatus{PrivacyStatus: privacy},
+	}
+}
+
+func (y *YouTube) CreatePlaylist(details Details) (string, error) {
+	var response *youtube.Playlist
+	err := y.call(QuotaWrite, func() (err error) {
+		response, err = y.Service.Playlists.Insert([]string{"snippet", "status"}, youtubePlaylist(details)).Do()
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return response.Id, nil
+}
+
+func (y *YouTube) UpdatePlaylist(playlistID string, details Details) error {
+	update := youtubePlaylist(details)
+	update.Id = playlistID
+	return y.call(QuotaWrite, func() error {
+		_, err := y.Service.Playlists.Update([]string{"snippet", "status"}, update).Do()
+		return err
+	})
+}
+
+func (y *YouTube) Items(playlistID, pageToken string) ([]Item, string, error) {
+	if y.Service == nil {
+		return nil, "", ErrNotConfigured
+	}
+	list := y.Service.PlaylistItems.List([]string{"contentDetails"}).PlaylistId(playlistID).MaxResults(50)
+	if pageToken != "" {
+		list = list.PageToken(pageToken)
+	}
+	var response *youtube.PlaylistItemListResponse
+	err := y.call(QuotaRead, func() (err error) {
+		response, err = list.Do()
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	var items []Item
+	for _, video := range response.Items {
+		items = append(items, Item{ID: video.Id, TrackID: video.ContentDetails.VideoId, Note: video.ContentDetails.Note})
+	}
+	return items, response.NextPageToken, nil
+}
+
+func (y *YouTube) Add(playlistID, trackID string, position int) (Item, error) {
+	video := &youtube.PlaylistItem{
+		Snippet: &youtube.PlaylistItemSnippet{
+			PlaylistId: playlistID,
+			ResourceId: &youtube.ResourceId{
+				Kind:    "youtube#video",
+				VideoId: trackID,
+			},
+			Position: int64(position),
+			// Position 0 would otherwise be dropped, putting the video at the end
+			ForceSendFields: []string{"Position"},
+		},
+	}
+	var response *youtube.PlaylistItem
+	err := y.call(QuotaWrite, func() (err error) {
+		response, err = y.Service.PlaylistItems.Insert([]string{"snippet"}, video).Do()
+		return err
+	})
+	if err != nil {
+		return Item{}, err
+	}
+	return Item{ID: response.Id, TrackID: trackID, Position: position}, nil
+}
+
+func (y *YouTube) Move(playlistID string, item Item, from, to int) error {
+	video := &youtube.PlaylistItem{
+		Id: item.ID,
+		Snippet: &youtube.PlaylistItemSnippet{
+			PlaylistId: playlistID,
+			ResourceId: &youtube.ResourceId{
+				Kind:    "youtube#video",
+				VideoId: item.TrackID,
+			},
+			Position:        int64(to),
+			ForceSendFields: []string{"Position"},
+		},
+	}
+	return y.call(QuotaWrite, func() error {
+		_, err := y.Service.PlaylistItems.Update([]string{"snippet"}, video).Do()
+		return err
+	})
+}
+
+func (y *YouTube) Remove(playlistID string, item Item) error {
+	return y.call(QuotaWrite, func() error {
+		return y.Service.PlaylistItems.Delete(item.ID).Do()
+	})
+}
+
+// maxNoteLength is the longest note YouTube will take on a playlist entry
+const maxNoteLength = 280
+
+// SetNote changes an entry's note. YouTube wants the whole snippet back when updating, position and all
+func (y *YouTube) SetNote(playlistID string, item Item, note string) error {
+	video := &youtube.PlaylistItem{
+		Id: item.ID,
+		Snippet: &youtube.PlaylistItemSnippet{
+			PlaylistId: playlistID,
+			ResourceId: &youtube.ResourceId{
+				Kind:    "youtube#video",
+				VideoId: item.TrackID,
+			},
+			Position:        int64(item.Position),
+			ForceSendFields: []string{"Position"},
+		},
+		ContentDetails: &youtube.PlaylistItemContentDetails{
+			Note: truncate(note, maxNoteLength),
+		},
+	}
+	return y.call(QuotaWrite, func() error {
+		_, err := y.Service.PlaylistItems.Update([]string{"snippet", "contentDetails"}, video).Do()
+		return err
+	})
+}
+
+// Match searches YouTube for the song. Searches are expensive on quota, so callers should remember the answer
+func (y *YouTube) Match(song Song) (string, error) {
+	var response *youtube.SearchListResponse
+	err := y.call(QuotaSearch, func() (err error) {
+		response, err = y.Service.Search.List([]string{"id"}).Q(searchQuery(song)).Type("video").VideoCategoryId("10").MaxResults(1).Do()
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(response.Items) == 0 || response.Items[0].Id == nil {
+		return "", ErrNoMatch
+	}
+	return response.Items[0].Id.VideoId, nil
+}
+
+func (y *YouTube) URL(playlistID string) string {
+	return "https://youtube.com/playlist?list=" + playlistID
+}
+
+// truncate cuts s down to at most max characters
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/bwmarrin/discordgo"
+	"github.com/mfcrocker/kazooiebot/playlist"
+)
+
+// youtubeQuota keeps track of how much of YouTube's daily API quota we've got through. Every song added,
+// moved or removed costs 50 units, so a month-wide playlist can eat a good chunk of it
+var youtubeQuota = &playlist.Quota{}
+
+// queuedPlaylist is a playlist we couldn't finish for quota reasons and will come back to
+type queuedPlaylist struct {
+	GuildID     string    `firestore:"guildID"`
+	Month       string    `firestore:"month"`
+	UserID      string    `firestore:"userID"`
+	Username    string    `firestore:"username"`
+	Day         int       `firestore:"day"`
+	Kind        string    `firestore:"kind"`
+	ChannelID   string    `firestore:"channelID"`
+	RequestedBy []string  `firestore:"requestedBy"`
+	RetryAt     time.Time `firestore:"retryAt"`
+}
+
+// playlistJob is a playlist waiting to be built, along with everyone waiting on it
+type playlistJob struct {
+	guildID  string
+	month    string
+	userID   string
+	username string
+	day      int
+	kind     string
+	// run, if set, is done instead of building a playlist, for other work that has to take turns with the syncs
+	run     func() (string, time.Time)
+	waiting []func(response string, retryAt time.Time)
+}
+
+// playlistWorker builds playlists one at a time in the background, so we never have two syncs fighting over the same
+// playlist and Discord isn't left hanging while we talk to YouTube
+var playlistWorker = struct {
+	sync.Mutex
+	jobs  map[string]*playlistJob
+	queue []string
+	wake  chan struct{}
+}{jobs: map[string]*playlistJob{}, wake: make(chan struct{}, 1)}
+
+// changedMonthPlaylists are months with new picks since their month-wide playlists were last synced, along with the
+// guild whose settings they're made with
+var changedMonthPlaylists = struct {
+	sync.Mutex
+	months map[string]string
+}{months: map[string]string{}}
+
+// quotaRetryAt tells us when it's worth trying again if err came from running out of quota
+func quotaRetryAt(err error) (time.Time, bool) {
+	var quotaErr *playlist.QuotaError
+	if errors.As(err, &quotaErr) {
+		return quotaErr.RetryAt, true
+	}
+	return time.Time{}, false
+}
+
+// relativeTime formats t so Discord shows it as eg "in 3 hours" in the reader's own time
+func relativeTime(t time.Time) string {
+	return "<t:" + strconv.FormatInt(t.Unix(), 10) + ":R>"
+}
+
+// queuedPlaylistID is the same for every request for the same playlist, so asking twice doesn't queue it twice
+func queuedPlaylistID(monthName, userID string, day int, kind string) string {
+	return strings.Replace(monthName, " ", "-", -1) + "-" + userID + "-" + strconv.Itoa(day) + "-" + kind
+}
+
+// queuePlaylistSync puts a playlist in line to be built. If it's already in line done waits on that job instead of
+// building it twice. done can be nil
+func queuePlaylistSync(guildID, monthName, userID, username string, day int, kind string, done func(response string, retryAt time.Time)) {
+	key := queuedPlaylistID(monthName, userID, day, kind)
+	playlistWorker.Lock()
+	defer playlistWorker.Unlock()
+	job, ok := playlistWorker.jobs[key]
+	if !ok {
+		job = &playlistJob{guildID: guildID, month: monthName, userID: userID, username: username, day: day, kind: kind}
+		playlistWorker.jobs[key] = job
+		playlistWorker.queue = append(playlistWorker.queue, key)
+	}
+	if done != nil {
+		job.waiting = append(job.waiting, done)
+	}
+	select {
+	case playlistWorker.wake <- struct{}{}:
+	default:
+	}
+}
+
+// queueRetitle puts retitling a guild's playlists in line behind any syncs, so the two never change the same playlist at
+// once. monthName can be empty to retitle every month's
+func queueRetitle(guildID, monthName string, done func(response string, retryAt time.Time)) {
+	key := "retitle-" + guildID + "-" + strings.Replace(monthName, " ", "-", -1)
+	playlistWorker.Lock()
+	defer playlistWorker.Unlock()
+	job, ok := playlistWorker.jobs[key]
+	if !ok {
+		job = &playlistJob{guildID: guildID, month: monthName, run: func() (string, time.Time) {
+			// Read the settings when we get to it, in case they've changed while we waited
+			updated, err := retitlePlaylists(guildID, loadMusicConfig(guildID), monthName)
+			response := "Updated " + strconv.Itoa(updated) + " playlist(s)"
+			if retryAt, ok := quotaRetryAt(err); ok {
+				return response + ", then ran out of quota - run this again " + relativeTime(retryAt) + " to finish", retryAt
+			}
+			if err != nil {
+				log.Printf("Error retitling playlists: %v", err)
+				return "Something went wrong at my end so I couldn't find the playlists", time.Time{}
+			}
+			return response, time.Time{}
+		}}
+		playlistWorker.jobs[key] = job
+		playlistWorker.queue = append(playlistWorker.queue, key)
+	}
+	job.waiting = append(job.waiting, done)
+	select {
+	case playlistWorker.wake <- struct{}{}:
+	default:
+	}
+}
+
+// playlistsQueued is how many playlists are waiting to be built
+func playlistsQueued() int {
+	playlistWorker.Lock()
+	defer playlistWorker.Unlock()
+	return len(playlistWorker.queue)
+}
+
+// runPlaylistWorker builds queued playlists forever
+func runPlaylistWorker() {
+	for {
+		playlistWorker.Lock()
+		if len(playlistWorker.queue) == 0 {
+			playlistWorker.Unlock()
+			<-playlistWorker.wake
+			continue
+		}
+		key := playlistWorker.queue[0]
+		playlistWorker.queue = playlistWorker.queue[1:]
+		job := playlistWorker.jobs[key]
+		// Anyone asking from here on gets a fresh sync, in case they're after songs we've already read past
+		delete(playlistWorker.jobs, key)
+		playlistWorker.Unlock()
+
+		var response string
+		var retryAt time.Time
+		if job.run != nil {
+			response, retryAt = job.run()
+		} else {
+			response, retryAt = updateAndCreatePlaylists(job.guildID, job.month, job.userID, job.username, job.day, job.kind)
+		}
+		for _, done := range job.waiting {
+			done(response, retryAt)
+		}
+	}
+}
+
+// requestPlaylists builds playlists for someone asking in a channel, editing msg with the result when it's done. Anything
+// that's waiting on quota is remembered so we can finish it later and post it there
+func requestPlaylists(s *discordgo.Session, i *discordgo.InteractionCreate, msg *discordgo.Message, monthName, userID, username string, day int, kind string) {
+	// Say how long the wait is before queueing, so we can't trample on the result if it's quick
+	if ahead := playlistsQueued(); ahead > 0 {
+		s.FollowupMessageEdit(s.State.User.ID, i.Interaction, msg.ID, &discordgo.WebhookEdit{
+			Content: "Working on it! There's " + strconv.Itoa(ahead) + " other playlist(s) to get through first",
+		})
+	}
+	queuePlaylistSync(i.GuildID, monthName, userID, username, day, kind, func(response string, retryAt time.Time) {
+		if !retryAt.IsZero() {
+			response += deferPlaylist(i.GuildID, i.ChannelID, i.Member.User.ID, monthName, userID, username, day, kind, retryAt)
+		}
+		err := s.FollowupMessageEdit(s.State.User.ID, i.Interaction, msg.ID, &discordgo.WebhookEdit{
+			Content: truncate(response, maxMessageLength),
+		})
+		if err != nil {
+			// Discord only lets us edit for so long after the command, so fall back to a fresh message
+			s.ChannelMessageSend(i.ChannelID, truncate("<@"+i.Member.User.ID+"> "+response, maxMessageLength))
+		}
+	})
+}
+
+// deferPlaylist queues up a playlist to finish once there's quota, returning what to tell the person who asked
+func deferPlaylist(guildID, channelID, requesterID, monthName, userID, username string, day int, kind string, retryAt time.Time) string {
+	_, err := firestoreClient.Collection("playlistqueue").Doc(queuedPlaylistID(monthName, userID, day, kind)).Set(ctx, map[string]interface{}{
+		"guildID":     guildID,
+		"month":       monthName,
+		"userID":      userID,
+		"username":    username,
+		"day":         day,
+		"kind":        kind,
+		"channelID":   channelID,
+		"requestedBy": firestore.ArrayUnion(requesterID),
+		"retryAt":     retryAt,
+	}, firestore.MergeAll)
+	if err != nil {
+		log.Printf("Error queueing a playlist: %v", err)
+		return "\nI couldn't queue it up either, so ask again " + relativeTime(retryAt)
+	}
+	return "\nI'll post here when it's done"
+}
+
+// checkQueuedPlaylists picks up playlists we had to put off once there's quota to finish them
+func checkQueuedPlaylists() {
+	docs, err := firestoreClient.Collection("playlistqueue").Where("retryAt", "<=", time.Now()).Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("Error getting queued playlists: %v", err)
+		return
+	}
+	for _, doc := range docs {
+		var queued queuedPlaylist
+		if err := doc.DataTo(&queued); err != nil {
+			log.Printf("Error reading a queued playlist: %v", err)
+			continue
+		}
+		// Keep the next check from queueing it again while it waits its turn
+		ref := doc.Ref
+		ref.Update(ctx, []firestore.Update{{Path: "retryAt", Value: time.Now().Add(time.Hour)}})
+		if queued.GuildID == "" {
+			queued.GuildID = *GuildID
+		}
+		if queued.Kind == "" {
+			queued.Kind = playlistKind(queued.UserID, queued.Day)
+		}
+		queuePlaylistSync(queued.GuildID, queued.Month, queued.UserID, queued.Username, queued.Day, queued.Kind, func(response string, retryAt time.Time) {
+			if !retryAt.IsZero() {
+				// Still not enough quota, so go round again
+				ref.Update(ctx, []firestore.Update{{Path: "retryAt", Value: retryAt}})
+				return
+			}
+			var mentions []string
+			for _, userID := range queued.RequestedBy {
+				mentions = append(mentions, "<@"+userID+">")
+			}
+			_, err := session.ChannelMessageSend(queued.ChannelID, truncate(strings.Join(mentions, " ")+" your playlist's finished!\n"+response, maxMessageLength))
+			if err != nil {
+				log.Printf("Error posting a queued playlist: %v", err)
+			}
+			ref.Delete(ctx)
+		})
+	}
+}
+
+// monthPlaylistChanged notes that a month's picks have changed, so its month-wide playlists need a sync
+func monthPlaylistChanged(guildID, monthName string) {
+	changedMonthPlaylists.Lock()
+	defer changedMonthPlaylists.Unlock()
+	changedMonthPlaylists.months[monthName] = guildID
+}
+
+// syncMonthPlaylists keeps month-wide playlists up to date as songs come in. Only playlists someone's already asked for
+// are synced; we don't make new ones off our own bat
+func syncMonthPlaylists() {
+	changedMonthPlaylists.Lock()
+	months := changedMonthPlaylists.months
+	changedMonthPlaylists.months = map[string]string{}
+	changedMonthPlaylists.Unlock()
+
+	for monthName, guildID := range months {
+		monthName, guildID := monthName, guildID
+		docs, err := firestoreClient.Collection("musicplaylists").Where("userID", "==", "").Where("month", "==", monthName).Where("day", "==", 0).Documents(ctx).GetAll()
+		if err != nil {
+			log.Printf("Error finding month playlists: %v", err)
+			monthPlaylistChanged(guildID, monthName)
+			continue
+		}
+		// Both the plain and by-prompt month playlists cover every pick
+		kinds := map[string]bool{}
+		for _, doc := range docs {
+			kind, ok := doc.Data()["kind"].(string)
+			if !ok {
+				kind = playlistMonth
+			}
+			kinds[kind] = true
+		}
+		for kind := range kinds {
+			queuePlaylistSync(guildID, monthName, "", "", 0, kind, func(response string, retryAt time.Time) {
+				if !retryAt.IsZero() {
+					// Try again once there's quota
+					monthPlaylistChanged(guildID, monthName)
+				}
+			})
+		}
+	}
+}
+
+// resyncPlaylists queues syncs for every playlist we've made that a member's pick for a day would be on
+func resyncPlaylists(guildID, monthName, userID, username string, day int) {
+	docs, err := firestoreClient.Collection("musicplaylists").Where("month", "==", monthName).Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("Error finding playlists to resync: %v", err)
+		return
+	}
+	for _, doc := range docs {
+		var saved struct {
+			UserID string `firestore:"userID"`
+			Day    int    `firestore:"day"`
+			Kind   string `firestore:"kind"`
+		}
+		if err := doc.DataTo(&saved); err != nil {
+			continue
+		}
+		if saved.Kind == "" {
+			saved.Kind = playlistKind(saved.UserID, saved.Day)
+		}
+		switch {
+		case saved.UserID == "" && saved.Day == 0:
+		case saved.UserID == "" && saved.Day == day:
+		case saved.UserID == userID && saved.Day == 0:
+		default:
+			continue
+		}
+		savedUsername := ""
+		if saved.UserID != "" {
+			savedUsername = username
+		}
+		// Providers share a queue entry, so this only syncs each playlist once
+		queuePlaylistSync(guildID, monthName, saved.UserID, savedUsername, saved.Day, saved.Kind, nil)
+	}
+}
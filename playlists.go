@@ -0,0 +1,264 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/mfcrocker/kazooiebot/links"
+	"github.com/mfcrocker/kazooiebot/playlist"
+)
+
+// Kinds of playlist, which each get their own title and description
+const (
+	playlistMonth   = "month"
+	playlistDay     = "day"
+	playlistMember  = "member"
+	playlistPrompts = "prompts"
+)
+
+var defaultPlaylistTitles = map[string]string{
+	playlistMonth:   "Speedfriends Music Month: {month}",
+	playlistDay:     "Speedfriends Music Month: {month} Day {day} - {prompt}",
+	playlistMember:  "Speedfriends Music Month: {month} - {user}",
+	playlistPrompts: "Speedfriends Music Month: {month} by prompt",
+}
+
+var defaultPlaylistDescriptions = map[string]string{
+	playlistMonth:   "All the songs posted for {month}'s music month in Speedfriends",
+	playlistDay:     "All the songs posted on day {day} of {month}'s music month in Speedfriends, where the prompt was: {prompt}",
+	playlistMember:  "All the songs posted by {user} for {month}'s music month in Speedfriends",
+	playlistPrompts: "All the songs posted for {month}'s music month in Speedfriends, day by day:\n{prompts}",
+}
+
+// playlistKind works out which kind of playlist covers a member and/or day, for playlists saved before we kept track
+func playlistKind(userID string, day int) string {
+	if userID != "" {
+		return playlistMember
+	}
+	if day != 0 {
+		return playlistDay
+	}
+	return playlistMonth
+}
+
+// playlistDetails fills in the guild's title and description templates for a playlist. Anything left dangling off the
+// end by an empty placeholder, like a day without a prompt, is tidied away
+func playlistDetails(config musicConfig, monthName, username string, day int, kind string) playlist.Details {
+	title, ok := config.PlaylistTitles[kind]
+	if !ok || title == "" {
+		title = defaultPlaylistTitles[kind]
+	}
+	description, ok := config.PlaylistDescriptions[kind]
+	if !ok || description == "" {
+		description = defaultPlaylistDescriptions[kind]
+	}
+
+	dayText, prompt, prompts := "", "", ""
+	if m, ok := findMusicMonthByName(monthName); ok {
+		if day != 0 {
+			prompt, _ = m.prompt(day)
+		}
+		var lines []string
+		for _, d := range m.Days {
+			lines = append(lines, "Day "+strconv.Itoa(d.Day)+": "+d.Prompt)
+		}
+		prompts = strings.Join(lines, "\n")
+	}
+	if day != 0 {
+		dayText = strconv.Itoa(day)
+	}
+	placeholders := strings.NewReplacer("{month}", monthName, "{day}", dayText, "{user}", username, "{prompt}", prompt, "{prompts}", prompts)
+	return playlist.Details{
+		Title:       tidyTemplate(placeholders.Replace(title)),
+		Description: tidyTemplate(placeholders.Replace(description)),
+		Privacy:     config.PlaylistPrivacy,
+	}
+}
+
+// tidyTemplate trims the separators an empty placeholder at the end of a template leaves behind
+func tidyTemplate(s string) string {
+	return strings.TrimRight(strings.TrimSpace(s), " -:")
+}
+
+// promptNotes notes the day, prompt and picker for each track on a by-prompt playlist
+func promptNotes(monthName string, trackSubs map[string]submission) map[string]string {
+	m, ok := findMusicMonthByName(monthName)
+	if !ok {
+		return nil
+	}
+	usernames := map[string]string{}
+	notes := map[string]string{}
+	for trackID, sub := range trackSubs {
+		username, ok := usernames[sub.UserID]
+		if !ok {
+			if user, err := session.User(sub.UserID); err == nil {
+				username = user.Username
+			}
+			usernames[sub.UserID] = username
+		}
+		note := "Day " + strconv.Itoa(sub.Day)
+		if prompt, ok := m.prompt(sub.Day); ok {
+			note += ": " + prompt
+		}
+		if username != "" {
+			note += " (picked by " + username + ")"
+		}
+		notes[trackID] = note
+	}
+	return notes
+}
+
+var providerNames = map[string]string{
+	string(links.YouTube): "YouTube",
+	string(links.Spotify): "Spotify",
+}
+
+func hasPlaylistProvider(name string) bool {
+	for _, p := range playlistProviders {
+		if p.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// selectSubmissions picks out a month's picks, optionally narrowed to one member and/or one day.
+// Sealed picks only show up when they're the member's own
+func selectSubmissions(monthName, userID string, day int) []submission {
+	query := firestoreClient.Collection("music").Where("month", "==", monthName)
+	if userID != "" {
+		query = query.Where("userID", "==", userID)
+	}
+	if day != 0 {
+		query = query.Where("day", "==", day)
+	}
+	docs, _ := query.Documents(ctx).GetAll()
+	var subs []submission
+	for _, doc := range docs {
+		var sub submission
+		if err := doc.DataTo(&sub); err != nil {
+			continue
+		}
+		if userID == "" && sub.Sealed {
+			// Don't spoil picks that haven't been revealed yet
+			continue
+		}
+		sub.ID = doc.Ref.ID
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// trackFor finds a pick's track on a provider, searching for songs posted from elsewhere and remembering what we found
+func trackFor(p playlist.Provider, sub submission) (string, bool) {
+	link, ok := sub.link()
+	if !ok {
+		return "", false
+	}
+	if string(link.Provider) == p.Name() {
+		return link.ID, true
+	}
+	if trackID, ok := sub.Matches[p.Name()]; ok {
+		// An empty match means we've looked before and found nothing
+		return trackID, trackID != ""
+	}
+
+	song := playlist.Song{Title: sub.Title, Artist: sub.Artist}
+	if link.Provider == links.Spotify && spotifyClient != nil {
+		// Spotify's oEmbed doesn't tell us the artist
+		if track, err := spotifyClient.Track(link.ID); err == nil {
+			song = track
+		}
+	}
+	if song.Title == "" {
+		return "", false
+	}
+
+	trackID, err := p.Match(song)
+	if err != nil && err != playlist.ErrNoMatch {
+		log.Printf("Error matching a song on %v: %v", p.Name(), err)
+		return "", false
+	}
+	if sub.ID != "" {
+		_, err = firestoreClient.Collection("music").Doc(sub.ID).Update(ctx, []firestore.Update{
+			{FieldPath: firestore.FieldPath{"matches", p.Name()}, Value: trackID},
+		})
+		if err != nil {
+			log.Printf("Error saving record to Firestore: %v", err)
+		}
+	}
+	return trackID, trackID != ""
+}
+
+// retitlePlaylists brings the details of the guild's playlists in line with its settings, optionally just for one month.
+// It stops early if a provider runs out of quota
+func retitlePlaylists(guildID string, config musicConfig, monthName string) (int, error) {
+	query := firestoreClient.Collection("musicplaylists").Query
+	if monthName != "" {
+		query = query.Where("month", "==", monthName)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+
+	usernames := map[string]string{}
+	updated := 0
+	for _, doc := range docs {
+		var saved struct {
+			GuildID    string `firestore:"guildID"`
+			UserID     string `firestore:"userID"`
+			Month      string `firestore:"month"`
+			Day        int    `firestore:"day"`
+			PlaylistID string `firestore:"playlistID"`
+			Provider   string `firestore:"provider"`
+			Kind       string `firestore:"kind"`
+		}
+		if err := doc.DataTo(&saved); err != nil {
+			continue
+		}
+		if saved.GuildID == "" {
+			// Playlists from before we noted the guild were all made for the home one
+			saved.GuildID = *GuildID
+		}
+		if saved.GuildID != guildID {
+			continue
+		}
+		if saved.Kind == "" {
+			saved.Kind = playlistKind(saved.UserID, saved.Day)
+		}
+		if saved.Provider == "" {
+			// Playlists from before we had more than one provider are all on YouTube
+			saved.Provider = string(links.YouTube)
+		}
+		var p playlist.Provider
+		for _, candidate := range playlistProviders {
+			if candidate.Name() == saved.Provider {
+				p = candidate
+			}
+		}
+		if p == nil {
+			continue
+		}
+
+		username, ok := usernames[saved.UserID]
+		if saved.UserID != "" && !ok {
+			if user, err := session.User(saved.UserID); err == nil {
+				username = user.Username
+			}
+			usernames[saved.UserID] = username
+		}
+		details := playlistDetails(config, saved.Month, username, saved.Day, saved.Kind)
+		if err := p.UpdatePlaylist(saved.PlaylistID, details); err != nil {
+			if _, ok := quotaRetryAt(err); ok {
+				return updated, err
+			}
+			log.Printf("Error updating a %v playlist's details: %v", p.Name(), err)
+			continue
+		}
+		updated++
+	}
+	return updated, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// favouritesShown is how many favourite artists make it onto a profile
+const favouritesShown = 10
+
+// monthProfile is one member's picks for one month
+type monthProfile struct {
+	Month         *month
+	Subs          []submission
+	LongestStreak int
+}
+
+// memberProfile sums up everything a member has picked across every music month
+type memberProfile struct {
+	Months        []monthProfile
+	Songs         int
+	Votes         int
+	Duration      int
+	LongestStreak int
+	Favourites    []artistCount
+}
+
+type artistCount struct {
+	Artist string
+	Count  int
+}
+
+// buildProfile gathers a member's picks from every month, oldest month first. Profiles are posted for everyone to see,
+// so sealed picks are left out
+func buildProfile(userID string) memberProfile {
+	docs, _ := firestoreClient.Collection("music").Where("userID", "==", userID).Documents(ctx).GetAll()
+	byMonth := map[string][]submission{}
+	var all []submission
+	for _, doc := range docs {
+		var sub submission
+		if err := doc.DataTo(&sub); err != nil || sub.Sealed {
+			continue
+		}
+		sub.ID = doc.Ref.ID
+		all = append(all, sub)
+	}
+	all = enrichSubmissions(all)
+
+	var profile memberProfile
+	artists := map[string]int{}
+	for _, sub := range all {
+		byMonth[sub.Month] = append(byMonth[sub.Month], sub)
+		profile.Songs++
+		profile.Votes += sub.Votes
+		profile.Duration += sub.seconds()
+		artist := sub.Artist
+		if artist == "" {
+			artist = sub.Channel
+		}
+		if artist != "" {
+			artists[artist]++
+		}
+	}
+
+	for monthName, subs := range byMonth {
+		m, ok := findMusicMonthByName(monthName)
+		if !ok {
+			continue
+		}
+		sort.Slice(subs, func(a, b int) bool {
+			return subs[a].Day < subs[b].Day
+		})
+		mp := monthProfile{Month: m, Subs: subs}
+		if stats := monthStats(m, subs, len(m.Days)); len(stats) > 0 {
+			mp.LongestStreak = stats[0].LongestStreak
+		}
+		if mp.LongestStreak > profile.LongestStreak {
+			profile.LongestStreak = mp.LongestStreak
+		}
+		profile.Months = append(profile.Months, mp)
+	}
+	sort.Slice(profile.Months, func(a, b int) bool {
+		return profile.Months[a].Month.StartTime.Before(profile.Months[b].Month.StartTime)
+	})
+
+	for artist, count := range artists {
+		profile.Favourites = append(profile.Favourites, artistCount{Artist: artist, Count: count})
+	}
+	sort.Slice(profile.Favourites, func(a, b int) bool {
+		if profile.Favourites[a].Count != profile.Favourites[b].Count {
+			return profile.Favourites[a].Count > profile.Favourites[b].Count
+		}
+		return profile.Favourites[a].Artist < profile.Favourites[b].Artist
+	})
+	if len(profile.Favourites) > favouritesShown {
+		profile.Favourites = profile.Favourites[:favouritesShown]
+	}
+	return profile
+}
+
+// profilePages lays a profile out as an overview followed by a page per month
+func profilePages(user *discordgo.User, profile memberProfile) []*discordgo.MessageEmbed {
+	title := user.Username + "'s music months"
+	var overview strings.Builder
+	overview.WriteString("**Songs picked:** " + strconv.Itoa(profile.Songs))
+	if profile.Duration > 0 {
+		overview.WriteString(" (" + formatDuration(time.Duration(profile.Duration)*time.Second) + " of music)")
+	}
+	overview.WriteString("\n**Months taken part in:** " + strconv.Itoa(len(profile.Months)))
+	overview.WriteString("\n**Longest streak:** " + strconv.Itoa(profile.LongestStreak) + " days")
+	overview.WriteString("\n**Votes received:** " + strconv.Itoa(profile.Votes))
+
+	var months []string
+	for _, mp := range profile.Months {
+		months = append(months, mp.Month.StartTime.Format("January 2006")+": "+strconv.Itoa(len(mp.Subs))+"/"+strconv.Itoa(len(mp.Month.Days))+" days, best streak "+strconv.Itoa(mp.LongestStreak))
+	}
+	var favourites []string
+	for n, fav := range profile.Favourites {
+		favourites = append(favourites, strconv.Itoa(n+1)+". "+fav.Artist+" ("+strconv.Itoa(fav.Count)+")")
+	}
+
+	first := &discordgo.MessageEmbed{
+		Title:       title,
+		Description: overview.String(),
+		Thumbnail:   &discordgo.MessageEmbedThumbnail{URL: user.AvatarURL("")},
+	}
+	if len(months) > 0 {
+		first.Fields = append(first.Fields, &discordgo.MessageEmbedField{Name: "Months", Value: fitLines(months, maxEmbedFieldLength)})
+	}
+	if len(favourites) > 0 {
+		first.Fields = append(first.Fields, &discordgo.MessageEmbedField{Name: "Favourite artists", Value: fitLines(favourites, maxEmbedFieldLength)})
+	}
+	pages := []*discordgo.MessageEmbed{first}
+
+	for _, mp := range profile.Months {
+		var lines []string
+		for _, sub := range mp.Subs {
+			prompt, _ := mp.Month.prompt(sub.Day)
+			lines = append(lines, "**Day "+strconv.Itoa(sub.Day)+"** ("+prompt+"): "+sub.describe())
+		}
+		for _, chunk := range chunkLines(lines, maxEmbedDescriptionLength) {
+			pages = append(pages, &discordgo.MessageEmbed{
+				Title:       title + ": " + mp.Month.StartTime.Format("January 2006"),
+				Description: chunk,
+			})
+		}
+	}
+	return pages
+}
+
+func handleMusicProfile(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if firestoreClient == nil {
+		// We're not connected to GCP, don't let them do this
+		respond(s, i, "I haven't been set up to allow music months, please moan at whoever set me up")
+		return
+	}
+	user := i.Member.User
+	if o, ok := options(i.Data.Options)["member"]; ok {
+		user = o.UserValue(s)
+	}
+
+	// Looking up every song someone's ever picked can take longer than Discord waits for a reply
+	respond(s, i, "Digging through "+user.Username+"'s music months")
+	profile := buildProfile(user.ID)
+	if profile.Songs == 0 {
+		s.FollowupMessageCreate(s.State.User.ID, i.Interaction, true, &discordgo.WebhookParams{
+			Content: user.Username + " hasn't picked any songs yet",
+		})
+		return
+	}
+	if _, err := sendPages(s, i.ChannelID, profilePages(user, profile)); err != nil {
+		log.Printf("Error sending a music profile: %v", err)
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/bwmarrin/discordgo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Where a suggested prompt is up to
+const (
+	promptPending  = "pending"
+	promptApproved = "approved"
+	promptRejected = "rejected"
+)
+
+// defaultAvoidMonths is how many months back a prompt has to have been used to be left out of a draft
+const defaultAvoidMonths = 3
+
+// untagged groups prompts nobody's tagged when a draft mixes categories
+const untagged = "untagged"
+
+// poolPrompt is a prompt someone's suggested for a future music month, stored in musicprompts keyed by its number
+type poolPrompt struct {
+	ID          string    `firestore:"-"`
+	Prompt      string    `firestore:"prompt"`
+	Key         string    `firestore:"key"`
+	Tags        []string  `firestore:"tags"`
+	Status      string    `firestore:"status"`
+	SuggestedBy string    `firestore:"suggestedBy"`
+	SuggestedAt time.Time `firestore:"suggestedAt"`
+	// UsedIn lists the months the prompt's been published in
+	UsedIn []string `firestore:"usedIn"`
+}
+
+// monthDraft is a generated month waiting for a server manager to publish it, stored in musicdrafts keyed by month name
+type monthDraft struct {
+	StartTime time.Time `firestore:"startTime"`
+	Days      []day     `firestore:"days"`
+	PromptIDs []string  `firestore:"promptIDs"`
+	CreatedBy string    `firestore:"createdBy"`
+}
+
+// promptKey is what we compare prompts on, so the same prompt written slightly differently still counts as the same
+func promptKey(prompt string) string {
+	return strings.Join(strings.Fields(strings.ToLower(prompt)), " ")
+}
+
+// parseTags reads a comma separated list of tags
+func parseTags(raw string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, tag := range strings.Split(raw, ",") {
+		tag = promptKey(tag)
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// describe is how a prompt is listed in the pool
+func (p poolPrompt) describe() string {
+	description := "**#" + p.ID + "** " + p.Prompt
+	if len(p.Tags) > 0 {
+		description += " [" + strings.Join(p.Tags, ", ") + "]"
+	}
+	if len(p.UsedIn) > 0 {
+		description += " (used " + strings.Join(p.UsedIn, ", ") + ")"
+	}
+	return description
+}
+
+// poolPrompts returns every prompt in the pool with the given status, oldest first
+func poolPrompts(promptStatus string) ([]poolPrompt, error) {
+	docs, err := firestoreClient.Collection("musicprompts").Where("status", "==", promptStatus).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	var prompts []poolPrompt
+	for _, doc := range docs {
+		var p poolPrompt
+		if err := doc.DataTo(&p); err == nil {
+			p.ID = doc.Ref.ID
+			prompts = append(prompts, p)
+		}
+	}
+	sort.Slice(prompts, func(a, b int) bool {
+		return prompts[a].SuggestedAt.Before(prompts[b].SuggestedAt)
+	})
+	return prompts, nil
+}
+
+// suggestPrompt adds a prompt to the pool to await approval, numbering it so server managers have something short to
+// refer to it by
+func suggestPrompt(prompt string, tags []string, userID string) (string, error) {
+	counter := firestoreClient.Collection("counters").Doc("musicprompts")
+	var id string
+	err := firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		next := int64(1)
+		doc, err := tx.Get(counter)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if last, ok := doc.Data()["last"].(int64); ok {
+				next = last + 1
+			}
+		}
+		id = strconv.FormatInt(next, 10)
+		if err := tx.Set(counter, map[string]interface{}{"last": next}); err != nil {
+			return err
+		}
+		return tx.Create(firestoreClient.Collection("musicprompts").Doc(id), map[string]interface{}{
+			"prompt":      prompt,
+			"key":         promptKey(prompt),
+			"tags":        tags,
+			"status":      promptPending,
+			"suggestedBy": userID,
+			"suggestedAt": time.Now(),
+		})
+	})
+	return id, err
+}
+
+// recentPromptKeys gathers the prompts used by months starting in the avoid months before start
+func recentPromptKeys(start time.Time, avoid int) (map[string]bool, error) {
+	docs, err := firestoreClient.Collection("musicmonth").Where("StartTime", ">=", start.AddDate(0, -avoid, 0)).Where("StartTime", "<", start).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]bool{}
+	for _, doc := range docs {
+		var m month
+		if err := doc.DataTo(&m); err != nil {
+			continue
+		}
+		for _, d := range m.Days {
+			keys[promptKey(d.Prompt)] = true
+		}
+	}
+	return keys, nil
+}
+
+// samplePrompts picks up to n prompts for a month. Prompts used recently are left out, ones that have never been used
+// go first, and categories take turns so the month doesn't end up all one kind of prompt. If tags are given only
+// prompts with one of them are considered
+func samplePrompts(pool []poolPrompt, recent map[string]bool, tags []string, n int, rng *rand.Rand) []poolPrompt {
+	wanted := map[string]bool{}
+	for _, tag := range tags {
+		wanted[tag] = true
+	}
+	groups := map[string][]poolPrompt{}
+	for _, p := range pool {
+		if recent[p.Key] {
+			continue
+		}
+		group := untagged
+		if len(p.Tags) > 0 {
+			group = p.Tags[rng.Intn(len(p.Tags))]
+		}
+		if len(wanted) > 0 {
+			group = ""
+			for _, tag := range p.Tags {
+				if wanted[tag] {
+					group = tag
+					break
+				}
+			}
+			if group == "" {
+				continue
+			}
+		}
+		groups[group] = append(groups[group], p)
+	}
+
+	var names []string
+	for name, prompts := range groups {
+		names = append(names, name)
+		rng.Shuffle(len(prompts), func(a, b int) {
+			prompts[a], prompts[b] = prompts[b], prompts[a]
+		})
+		// Shuffling first keeps the order random amongst the never-used and the used alike
+		sort.SliceStable(prompts, func(a, b int) bool {
+			return len(prompts[a].UsedIn) == 0 && len(prompts[b].UsedIn) > 0
+		})
+	}
+	sort.Strings(names)
+	rng.Shuffle(len(names), func(a, b int) {
+		names[a], names[b] = names[b], names[a]
+	})
+
+	var picked []poolPrompt
+	for len(picked) < n {
+		added := false
+		for _, name := range names {
+			if len(picked) == n {
+				break
+			}
+			if len(groups[name]) == 0 {
+				continue
+			}
+			picked = append(picked, groups[name][0])
+			groups[name] = groups[name][1:]
+			added = true
+		}
+		if !added {
+			break
+		}
+	}
+	rng.Shuffle(len(picked), func(a, b int) {
+		picked[a], picked[b] = picked[b], picked[a]
+	})
+	return picked
+}
+
+// draftMonth builds a draft for the month starting at start out of the pool
+func draftMonth(start time.Time, tags []string, avoid int, userID string) (monthDraft, error) {
+	pool, err := poolPrompts(promptApproved)
+	if err != nil {
+		return monthDraft{}, err
+	}
+	recent, err := recentPromptKeys(start, avoid)
+	if err != nil {
+		return monthDraft{}, err
+	}
+	daysInMonth := start.AddDate(0, 1, -1).Day()
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	draft := monthDraft{StartTime: start, CreatedBy: userID}
+	for n, p := range samplePrompts(pool, recent, tags, daysInMonth, rng) {
+		draft.Days = append(draft.Days, day{Day: n + 1, Prompt: p.Prompt})
+		draft.PromptIDs = append(draft.PromptIDs, p.ID)
+	}
+	return draft, nil
+}
+
+// findPoolPrompt looks up a prompt by number, telling them off if there isn't one
+func findPoolPrompt(s *discordgo.Session, i *discordgo.InteractionCreate, id int64) (*firestore.DocumentRef, poolPrompt, bool) {
+	ref := firestoreClient.Collection("musicprompts").Doc(strconv.FormatInt(id, 10))
+	var p poolPrompt
+	doc, err := ref.Get(ctx)
+	if err == nil {
+		err = doc.DataTo(&p)
+	}
+	if err != nil {
+		respondPrivately(s, i, "There's no prompt #"+strconv.FormatInt(id, 10)+" - see /musicprompt pool")
+		return nil, p, false
+	}
+	p.ID = ref.ID
+	return ref, p, true
+}
+
+// draftStart works out which month someone wants a draft for, telling them off if we can't
+func draftStart(s *discordgo.Session, i *discordgo.InteractionCreate, raw string) (time.Time, string, bool) {
+	monthName, ok := parseMonthName(raw)
+	if !ok {
+		respondPrivately(s, i, "I don't know which month "+raw+" is - try something like Jan 2021")
+		return time.Time{}, "", false
+	}
+	start, _ := time.Parse(musicMonthFormat, monthName)
+	if _, exists := findMusicMonthByName(monthName); exists {
+		respondPrivately(s, i, "There's already a music month in "+monthName)
+		return time.Time{}, "", false
+	}
+	return start, monthName, true
+}
+
+// handleMusicPromptPool deals with everything /musicprompt does besides getting a prompt
+func handleMusicPromptPool(s *discordgo.Session, i *discordgo.InteractionCreate, sub *discordgo.ApplicationCommandInteractionDataOption) {
+	if firestoreClient == nil {
+		// We're not connected to GCP, don't let them do this
+		respond(s, i, "I haven't been set up to allow music months, please moan at whoever set me up")
+		return
+	}
+	opts := options(sub.Options)
+	switch {
+	case (sub.Name == "draft" || sub.Name == "publish") && i.Member.User.ID != botOwnerID:
+		// Setting up months is mine to do, the same as /musicsetup
+		respondPrivately(s, i, "Please ask mfcrocker to set this up!")
+		return
+	case sub.Name != "suggest" && sub.Name != "pool" && !isMusicAdmin(s, i):
+		respondPrivately(s, i, "Only server managers can do that")
+		return
+	}
+
+	switch sub.Name {
+	case "suggest":
+		prompt := strings.TrimSpace(opts["prompt"].StringValue())
+		if prompt == "" {
+			respondPrivately(s, i, "You'll need to actually give me a prompt")
+			return
+		}
+		var tags []string
+		if o, ok := opts["tags"]; ok {
+			tags = parseTags(o.StringValue())
+		}
+		existing, err := firestoreClient.Collection("musicprompts").Where("key", "==", promptKey(prompt)).Limit(1).Documents(ctx).GetAll()
+		if err == nil && len(existing) > 0 {
+			respondPrivately(s, i, "Someone's already suggested that one (#"+existing[0].Ref.ID+")")
+			return
+		}
+		id, err := suggestPrompt(prompt, tags, i.Member.User.ID)
+		if err != nil {
+			log.Printf("Error saving a suggested prompt: %v", err)
+			respondPrivately(s, i, "Something went wrong at my end so I didn't save your prompt")
+			return
+		}
+		respondPrivately(s, i, "Thanks! That's prompt #"+id+", it'll go in the pool once a server manager approves it")
+	case "pool":
+		promptStatus := promptApproved
+		if o, ok := opts["status"]; ok {
+			promptStatus = o.StringValue()
+		}
+		prompts, err := poolPrompts(promptStatus)
+		if err != nil {
+			log.Printf("Error getting the prompt pool: %v", err)
+		}
+		if len(prompts) == 0 {
+			respond(s, i, "There aren't any "+promptStatus+" prompts")
+			return
+		}
+		var lines []string
+		for _, p := range prompts {
+			lines = append(lines, p.describe())
+		}
+		var pages []*discordgo.MessageEmbed
+		for _, chunk := range chunkLines(lines, maxEmbedDescriptionLength) {
+			pages = append(pages, &discordgo.MessageEmbed{
+				Title:       strings.Title(promptStatus) + " prompts",
+				Description: chunk,
+			})
+		}
+		respond(s, i, strconv.Itoa(len(prompts))+" "+promptStatus+" prompt(s) in the pool")
+		if _, err := sendPages(s, i.ChannelID, pages); err != nil {
+			log.Printf("Error sending the prompt pool: %v", err)
+		}
+	case "approve", "reject":
+		ref, p, ok := findPoolPrompt(s, i, opts["id"].IntValue())
+		if !ok {
+			return
+		}
+		updates := []firestore.Update{{Path: "status", Value: promptApproved}}
+		if sub.Name == "reject" {
+			updates[0].Value = promptRejected
+		}
+		if o, ok := opts["tags"]; ok {
+			p.Tags = parseTags(o.StringValue())
+			updates = append(updates, firestore.Update{Path: "tags", Value: p.Tags})
+		}
+		if _, err := ref.Update(ctx, updates); err != nil {
+			log.Printf("Error curating a prompt: %v", err)
+			respondPrivately(s, i, "Something went wrong at my end so I didn't save that")
+			return
+		}
+		if sub.Name == "reject" {
+			respondPrivately(s, i, "Rejected "+p.describe())
+		} else {
+			respondPrivately(s, i, "Approved "+p.describe())
+		}
+	case "draft":
+		start, monthName, ok := draftStart(s, i, opts["month"].StringValue())
+		if !ok {
+			return
+		}
+		var tags []string
+		if o, ok := opts["tags"]; ok {
+			tags = parseTags(o.StringValue())
+		}
+		avoid := defaultAvoidMonths
+		if o, ok := opts["avoid_months"]; ok && o.IntValue() >= 0 {
+			avoid = int(o.IntValue())
+		}
+		draft, err := draftMonth(start, tags, avoid, i.Member.User.ID)
+		if err != nil {
+			log.Printf("Error drafting a music month: %v", err)
+			respondPrivately(s, i, "Something went wrong at my end so I couldn't draft "+monthName)
+			return
+		}
+		if len(draft.Days) == 0 {
+			respondPrivately(s, i, "There aren't any approved prompts I can use for "+monthName+" - get suggesting!")
+			return
+		}
+		if _, err := firestoreClient.Collection("musicdrafts").Doc(monthName).Set(ctx, draft); err != nil {
+			log.Printf("Error saving record to Firestore: %v", err)
+			respondPrivately(s, i, "Something went wrong at my end so I didn't save the draft")
+			return
+		}
+		response := "Here's a draft for " + monthName + ". Draft it again for a different mix, or use /musicprompt publish to make it the real thing"
+		if daysInMonth := start.AddDate(0, 1, -1).Day(); len(draft.Days) < daysInMonth {
+			response += "\nThere were only enough prompts for " + strconv.Itoa(len(draft.Days)) + " of its " + strconv.Itoa(daysInMonth) + " days, so it'll need publishing with incomplete"
+		}
+		respond(s, i, response)
+		pages, _ := calendarPages(&month{StartTime: draft.StartTime, Days: draft.Days}, 0)
+		for _, page := range pages {
+			page.Title = "Draft music month: " + start.Format("January 2006")
+		}
+		if _, err := sendPages(s, i.ChannelID, pages); err != nil {
+			log.Printf("Error sending a music month draft: %v", err)
+		}
+	case "publish":
+		_, monthName, ok := draftStart(s, i, opts["month"].StringValue())
+		if !ok {
+			return
+		}
+		draftRef := firestoreClient.Collection("musicdrafts").Doc(monthName)
+		doc, err := draftRef.Get(ctx)
+		if err != nil {
+			respondPrivately(s, i, "There's no draft for "+monthName+" - make one with /musicprompt draft")
+			return
+		}
+		var draft monthDraft
+		if err := doc.DataTo(&draft); err != nil {
+			log.Printf("Error reading a music month draft: %v", err)
+			respondPrivately(s, i, "That draft's broken, try drafting it again")
+			return
+		}
+		m := month{StartTime: draft.StartTime, Days: draft.Days}
+		if len(m.Days) < m.length() && !boolOption(opts, "incomplete") {
+			respondPrivately(s, i, "That draft only has prompts for "+strconv.Itoa(len(m.Days))+" of "+monthName+"'s "+strconv.Itoa(m.length())+" days. Get some more prompts approved and draft it again, or publish with incomplete to go ahead anyway")
+			return
+		}
+		if _, _, err := firestoreClient.Collection("musicmonth").Add(ctx, m); err != nil {
+			log.Printf("Error saving record to Firestore: %v", err)
+			respondPrivately(s, i, "Something went wrong at my end so I didn't save the month")
+			return
+		}
+		for _, id := range draft.PromptIDs {
+			_, err := firestoreClient.Collection("musicprompts").Doc(id).Update(ctx, []firestore.Update{{Path: "usedIn", Value: firestore.ArrayUnion(monthName)}})
+			if err != nil {
+				log.Printf("Error marking prompt %v as used: %v", id, err)
+			}
+		}
+		draftRef.Delete(ctx)
+		respond(s, i, "Okay, I've set up a music month beginning on "+draft.StartTime.Format(prettyDateFormat)+" with "+strconv.Itoa(len(draft.Days))+" prompts")
+	}
+}
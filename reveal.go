@@ -0,0 +1,149 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// checkMusicReveals unseals and posts the day's picks for guilds in hidden mode once their reveal time has passed. Picks
+// still sealed from days gone by are unsealed whatever the setting now, in case hidden mode was turned off mid-month or
+// we missed a reveal
+func checkMusicReveals() {
+	docs, err := firestoreClient.Collection("musicconfig").Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("Something went wrong getting music configs on a cron: %v", err)
+		return
+	}
+	for _, doc := range docs {
+		config := defaultMusicConfig()
+		if err := doc.DataTo(&config); err != nil {
+			log.Printf("Couldn't read music config for %v: %v", doc.Ref.ID, err)
+			continue
+		}
+		now := time.Now().In(config.location())
+		unsealPastPicks(doc.Ref.ID, config, now)
+		if !config.Hidden || config.AnnounceChannel == "" {
+			continue
+		}
+		if now.Format("15:04") < config.RevealTime {
+			continue
+		}
+		revealMusicDay(doc.Ref.ID, config, now)
+	}
+}
+
+// unsealPastPicks unseals any picks for days that have finished in the guild's timezone
+func unsealPastPicks(guildID string, config musicConfig, now time.Time) {
+	docs, err := firestoreClient.Collection("music").Where("sealed", "==", true).Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("Error retrieving sealed picks: %v", err)
+		return
+	}
+	changed := map[string]bool{}
+	for _, doc := range docs {
+		var sub submission
+		if err := doc.DataTo(&sub); err != nil {
+			continue
+		}
+		start, err := time.Parse(musicMonthFormat, sub.Month)
+		if err != nil {
+			continue
+		}
+		if now.Before(time.Date(start.Year(), start.Month(), sub.Day+1, 0, 0, 0, 0, config.location())) {
+			continue
+		}
+		if _, err := doc.Ref.Update(ctx, []firestore.Update{{Path: "sealed", Value: false}}); err != nil {
+			log.Printf("Error unsealing a pick: %v", err)
+			continue
+		}
+		changed[sub.Month] = true
+	}
+	for monthName := range changed {
+		monthPlaylistChanged(guildID, monthName)
+	}
+}
+
+// revealTime is when a day's picks are due to be revealed in the guild's timezone
+func (c musicConfig) revealTime(m *month, day int) time.Time {
+	t, err := time.Parse("15:04", c.RevealTime)
+	if err != nil {
+		t, _ = time.Parse("15:04", defaultMusicConfig().RevealTime)
+	}
+	return time.Date(m.StartTime.Year(), m.StartTime.Month(), day, t.Hour(), t.Minute(), 0, 0, c.location())
+}
+
+// isRevealed reports whether a day's picks have already been revealed, so later picks needn't be sealed
+func isRevealed(guildID, monthName string, day int) bool {
+	_, err := firestoreClient.Collection("musicreveals").Doc(dayDocID(guildID, monthName, day)).Get(ctx)
+	return err == nil
+}
+
+func revealMusicDay(guildID string, config musicConfig, now time.Time) {
+	currentMonth, ok := findMusicMonth(now)
+	if !ok {
+		return
+	}
+	if _, ok := currentMonth.prompt(now.Day()); !ok {
+		return
+	}
+
+	// Claim the reveal first so we never post it twice
+	claim := firestoreClient.Collection("musicreveals").Doc(dayDocID(guildID, currentMonth.name(), now.Day()))
+	_, err := claim.Create(ctx, map[string]interface{}{
+		"guildID": guildID,
+		"month":   currentMonth.name(),
+		"day":     now.Day(),
+		"date":    now,
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving record to Firestore: %v", err)
+		return
+	}
+
+	docs, err := firestoreClient.Collection("music").Where("month", "==", currentMonth.name()).Where("day", "==", now.Day()).Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("Error retrieving picks to reveal: %v", err)
+		releaseReveal(claim)
+		return
+	}
+	var subs []submission
+	for _, doc := range docs {
+		var sub submission
+		if err := doc.DataTo(&sub); err != nil {
+			continue
+		}
+		sub.ID = doc.Ref.ID
+		if sub.Sealed {
+			if _, err := doc.Ref.Update(ctx, []firestore.Update{{Path: "sealed", Value: false}}); err != nil {
+				// unsealPastPicks will have another go once the day's over
+				log.Printf("Error unsealing a pick: %v", err)
+			}
+		}
+		subs = append(subs, sub)
+	}
+	if len(subs) == 0 {
+		return
+	}
+	monthPlaylistChanged(guildID, currentMonth.name())
+
+	prompt, _ := currentMonth.prompt(now.Day())
+	title := currentMonth.StartTime.Format("January") + " " + strconv.Itoa(now.Day()) + ": " + prompt
+	if err := postPicks(guildID, config.AnnounceChannel, title, currentMonth.name(), now.Day(), subs, config.Voting); err != nil {
+		releaseReveal(claim)
+	}
+}
+
+// releaseReveal lets go of a day's reveal claim so the next check tries again
+func releaseReveal(claim *firestore.DocumentRef) {
+	if _, err := claim.Delete(ctx); err != nil {
+		log.Printf("Error deleting record from Firestore: %v", err)
+	}
+}
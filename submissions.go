@@ -0,0 +1,114 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// handleMusicMine lists a member's picks for the current month, sealed ones included as they're their own
+func handleMusicMine(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// Go by the month running in the guild's timezone, the same one /music submit picks go into
+	m, ok := loadMusicConfig(i.GuildID).pickMonth(time.Now(), false)
+	if !ok {
+		respondPrivately(s, i, "No currently active music month")
+		return
+	}
+	subs := userSubmissions(i.Member.User.ID, m.name())
+	if len(subs) == 0 {
+		respondPrivately(s, i, "You haven't picked any songs for "+m.name()+" yet")
+		return
+	}
+	sort.Slice(subs, func(a, b int) bool {
+		return subs[a].Day < subs[b].Day
+	})
+
+	var lines []string
+	for _, sub := range subs {
+		prompt, _ := m.prompt(sub.Day)
+		line := "**Day " + strconv.Itoa(sub.Day) + "** (" + prompt + "): " + sub.describe()
+		if sub.Sealed {
+			line += " 🔒"
+		}
+		lines = append(lines, line)
+	}
+	// Private replies can't be paged, so this has to fit in one embed
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionApplicationCommandResponseData{
+			Flags: 64,
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       "Your picks for " + m.StartTime.Format("January 2006") + " (" + strconv.Itoa(len(subs)) + "/" + strconv.Itoa(len(m.Days)) + ")",
+					Description: fitLines(lines, maxEmbedDescriptionLength),
+				},
+			},
+		},
+	})
+}
+
+// handleMusicRemove withdraws a member's pick for a day, then brings any playlists it was on up to date
+func handleMusicRemove(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	config := loadMusicConfig(i.GuildID)
+	lastMonth := boolOption(opts, "last_month")
+	m, ok := config.pickMonth(time.Now(), lastMonth)
+	if !ok {
+		if lastMonth {
+			respondPrivately(s, i, "There wasn't a music month last month")
+			return
+		}
+		respondPrivately(s, i, "No currently active music month")
+		return
+	}
+	day := int(opts["day"].IntValue())
+	overridden, ok := deadlineOverridden(s, i, opts)
+	if !ok {
+		return
+	}
+	if !overridden {
+		if refusal := config.submissionRefusal(m, day, time.Now()); refusal != "" {
+			respondPrivately(s, i, refusal+", so it can't be withdrawn either")
+			return
+		}
+	}
+	docs, err := firestoreClient.Collection("music").Where("userID", "==", i.Member.User.ID).Where("month", "==", m.name()).Where("day", "==", day).Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("Error getting a pick to withdraw: %v", err)
+		respondPrivately(s, i, "Something went wrong at my end so I couldn't find your pick")
+		return
+	}
+	if len(docs) == 0 {
+		respondPrivately(s, i, "You haven't got a pick for day "+strconv.Itoa(day)+" to withdraw")
+		return
+	}
+	var sub submission
+	docs[0].DataTo(&sub)
+	for _, doc := range docs {
+		if err := deletePick(doc.Ref); err != nil {
+			log.Printf("Error withdrawing a pick: %v", err)
+			respondPrivately(s, i, "Something went wrong at my end so I couldn't withdraw your pick")
+			return
+		}
+	}
+
+	respondPrivately(s, i, "Withdrawn your pick of "+sub.describe()+" for day "+strconv.Itoa(day))
+	if !sub.Sealed {
+		resyncPlaylists(i.GuildID, m.name(), i.Member.User.ID, i.Member.User.Username, day)
+	}
+}
+
+// deadlineOverridden reports whether a server manager has asked to ignore the deadlines. Anyone else asking is told
+// they can't, and ok comes back false so the command stops there
+func deadlineOverridden(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (overridden, ok bool) {
+	if !boolOption(opts, "override") {
+		return false, true
+	}
+	if !isMusicAdmin(s, i) {
+		respondPrivately(s, i, "Only server managers can ignore the deadlines")
+		return false, false
+	}
+	return true, true
+}
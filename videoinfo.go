@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/mfcrocker/kazooiebot/links"
+	"github.com/mfcrocker/kazooiebot/playlist"
+	"google.golang.org/api/youtube/v3"
+)
+
+// videoInfo is what the YouTube Data API tells us about a video
+type videoInfo struct {
+	Title     string
+	Channel   string
+	Duration  time.Duration
+	Thumbnail string
+}
+
+// videosPerRequest is the most IDs Videos.List will take at once
+const videosPerRequest = 50
+
+// videoInfoCache remembers videos we've already looked up; their details hardly ever change
+var videoInfoCache = struct {
+	sync.Mutex
+	videos map[string]videoInfo
+}{videos: map[string]videoInfo{}}
+
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseISODuration reads the ISO 8601 durations YouTube uses, eg PT4M13S
+func parseISODuration(s string) (time.Duration, error) {
+	parts := isoDuration.FindStringSubmatch(s)
+	if parts == nil {
+		return 0, fmt.Errorf("bad duration %q", s)
+	}
+	var d time.Duration
+	for n, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if parts[n+1] == "" {
+			continue
+		}
+		v, _ := strconv.Atoi(parts[n+1])
+		d += time.Duration(v) * unit
+	}
+	return d, nil
+}
+
+// formatDuration renders a song length as 3:45, or 1:02:03 for long ones
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+// noDuration is stored as a pick's duration when YouTube can't give us one, eg for live streams or deleted videos, so we
+// don't keep asking
+const noDuration = -1
+
+// fetchVideoInfo looks up videos in batches, skipping any we've seen before. Videos that no longer exist come back with
+// no details at all
+func fetchVideoInfo(svc *youtube.Service, quota *playlist.Quota, ids []string) (map[string]videoInfo, error) {
+	found := map[string]videoInfo{}
+	var missing []string
+	seen := map[string]bool{}
+	videoInfoCache.Lock()
+	for _, id := range ids {
+		if info, ok := videoInfoCache.videos[id]; ok {
+			found[id] = info
+		} else if !seen[id] {
+			seen[id] = true
+			missing = append(missing, id)
+		}
+	}
+	videoInfoCache.Unlock()
+
+	for start := 0; start < len(missing); start += videosPerRequest {
+		end := start + videosPerRequest
+		if end > len(missing) {
+			end = len(missing)
+		}
+		var response *youtube.VideoListResponse
+		err := playlist.CallYouTube(quota, playlist.QuotaRead, func() (err error) {
+			response, err = svc.Videos.List([]string{"snippet", "contentDetails"}).Id(missing[start:end]...).Do()
+			return err
+		})
+		if err != nil {
+			return found, err
+		}
+		videoInfoCache.Lock()
+		for _, id := range missing[start:end] {
+			videoInfoCache.videos[id] = videoInfo{}
+			found[id] = videoInfo{}
+		}
+		for _, video := range response.Items {
+			info := videoInfo{}
+			if video.Snippet != nil {
+				info.Title = video.Snippet.Title
+				info.Channel = video.Snippet.ChannelTitle
+				if video.Snippet.Thumbnails != nil && video.Snippet.Thumbnails.High != nil {
+					info.Thumbnail = video.Snippet.Thumbnails.High.Url
+				}
+			}
+			if video.ContentDetails != nil {
+				info.Duration, _ = parseISODuration(video.ContentDetails.Duration)
+			}
+			videoInfoCache.videos[video.Id] = info
+			found[video.Id] = info
+		}
+		videoInfoCache.Unlock()
+	}
+	return found, nil
+}
+
+// enrichSubmissions fills in YouTube details for picks that don't have them yet, saving them for next time
+func enrichSubmissions(subs []submission) []submission {
+	if youtubeClient == nil || youtubeAuth == nil || !youtubeAuth.Authorised() {
+		return subs
+	}
+	var ids []string
+	for _, sub := range subs {
+		if link, ok := sub.link(); ok && link.Provider == links.YouTube && sub.Duration == 0 {
+			ids = append(ids, link.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return subs
+	}
+
+	videos, err := fetchVideoInfo(youtubeClient, youtubeQuota, ids)
+	if err != nil {
+		log.Printf("Error looking up YouTube videos: %v", err)
+	}
+	for n, sub := range subs {
+		link, ok := sub.link()
+		if !ok || link.Provider != links.YouTube || sub.Duration != 0 {
+			continue
+		}
+		info, ok := videos[link.ID]
+		if !ok {
+			continue
+		}
+		subs[n].Duration = int(info.Duration.Seconds())
+		if subs[n].Duration == 0 {
+			subs[n].Duration = noDuration
+		}
+		updates := []firestore.Update{{Path: "duration", Value: subs[n].Duration}}
+		// Deleted videos have nothing to tell us, so keep whatever we already had
+		if info.Title != "" {
+			subs[n].Title = info.Title
+			subs[n].Channel = info.Channel
+			subs[n].Thumbnail = info.Thumbnail
+			updates = append(updates,
+				firestore.Update{Path: "title", Value: info.Title},
+				firestore.Update{Path: "channel", Value: info.Channel},
+				firestore.Update{Path: "thumbnail", Value: info.Thumbnail},
+			)
+		}
+		if sub.ID == "" {
+			continue
+		}
+		_, err := firestoreClient.Collection("music").Doc(sub.ID).Update(ctx, updates)
+		if err != nil {
+			log.Printf("Error saving record to Firestore: %v", err)
+		}
+	}
+	return subs
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mfcrocker/kazooiebot/playlist"
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+)
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "PT4M13S", want: 4*time.Minute + 13*time.Second},
+		{in: "PT1H2M3S", want: time.Hour + 2*time.Minute + 3*time.Second},
+		{in: "PT15S", want: 15 * time.Second},
+		{in: "PT2H", want: 2 * time.Hour},
+		{in: "P1DT1H", want: 25 * time.Hour},
+		{in: "P0D", want: 0},
+		{in: "PT0S", want: 0},
+		{in: "4:13", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "PT4M13", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseISODuration(test.in)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseISODuration(%q) = %v, want an error", test.in, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseISODuration(%q) = %v, %v, want %v", test.in, got, err, test.want)
+		}
+	}
+}
+
+// fakeYouTube stands in for the videos.list endpoint, knowing about the videos it's given
+type fakeYouTube struct {
+	mu       sync.Mutex
+	videos   map[string]*youtube.Video
+	requests [][]string
+}
+
+func (f *fakeYouTube) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/youtube/v3/videos" {
+		http.NotFound(w, r)
+		return
+	}
+	var ids []string
+	for _, id := range r.URL.Query()["id"] {
+		ids = append(ids, strings.Split(id, ",")...)
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, ids)
+	f.mu.Unlock()
+
+	response := youtube.VideoListResponse{}
+	for _, id := range ids {
+		if video, ok := f.videos[id]; ok {
+			response.Items = append(response.Items, video)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func newFakeYouTube(t *testing.T, videos map[string]*youtube.Video) (*fakeYouTube, *youtube.Service) {
+	t.Helper()
+	fake := &fakeYouTube{videos: videos}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	svc, err := youtube.NewService(context.Background(), option.WithEndpoint(server.URL+"/"), option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every test starts from an empty cache
+	videoInfoCache.Lock()
+	videoInfoCache.videos = map[string]videoInfo{}
+	videoInfoCache.Unlock()
+	return fake, svc
+}
+
+func video(id, title, channel, duration string) *youtube.Video {
+	return &youtube.Video{
+		Id:             id,
+		Snippet:        &youtube.VideoSnippet{Title: title, ChannelTitle: channel},
+		ContentDetails: &youtube.VideoContentDetails{Duration: duration},
+	}
+}
+
+func TestFetchVideoInfo(t *testing.T) {
+	fake, svc := newFakeYouTube(t, map[string]*youtube.Video{
+		"song": video("song", "A Song", "A Channel", "PT3M30S"),
+		"live": video("live", "Live Now", "A Channel", "P0D"),
+	})
+	quota := &playlist.Quota{}
+
+	found, err := fetchVideoInfo(svc, quota, []string{"song", "live", "gone", "song"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (videoInfo{Title: "A Song", Channel: "A Channel", Duration: 210 * time.Second}); found["song"] != want {
+		t.Errorf("song = %+v, want %+v", found["song"], want)
+	}
+	if found["live"].Title != "Live Now" || found["live"].Duration != 0 {
+		t.Errorf("live = %+v, want a title and no duration", found["live"])
+	}
+	if info, ok := found["gone"]; !ok || info != (videoInfo{}) {
+		t.Errorf("gone = %+v, %v, want no details but still found", info, ok)
+	}
+	if len(fake.requests) != 1 || len(fake.requests[0]) != 3 {
+		t.Errorf("requests = %v, want one request for the three different videos", fake.requests)
+	}
+	if quota.Used() != playlist.QuotaRead {
+		t.Errorf("used %d units, want %d", quota.Used(), playlist.QuotaRead)
+	}
+
+	// Everything's cached now, including the video that's gone
+	if _, err := fetchVideoInfo(svc, quota, []string{"song", "gone"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.requests) != 1 {
+		t.Errorf("made %d requests, want the second lookup to come from the cache", len(fake.requests))
+	}
+}
+
+func TestFetchVideoInfoBatches(t *testing.T) {
+	fake, svc := newFakeYouTube(t, map[string]*youtube.Video{})
+	quota := &playlist.Quota{}
+	var ids []string
+	for n := 0; n < videosPerRequest+1; n++ {
+		ids = append(ids, "video"+strings.Repeat("x", n))
+	}
+	if _, err := fetchVideoInfo(svc, quota, ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.requests) != 2 || len(fake.requests[0]) != videosPerRequest || len(fake.requests[1]) != 1 {
+		t.Errorf("got requests for %d videos, want batches of %d then 1", len(fake.requests), videosPerRequest)
+	}
+	if quota.Used() != 2*playlist.QuotaRead {
+		t.Errorf("used %d units, want %d", quota.Used(), 2*playlist.QuotaRead)
+	}
+}
+
+func TestFetchVideoInfoOutOfQuota(t *testing.T) {
+	fake, svc := newFakeYouTube(t, map[string]*youtube.Video{"song": video("song", "A Song", "A Channel", "PT3M")})
+	quota := &playlist.Quota{}
+	quota.Exhaust()
+	_, err := fetchVideoInfo(svc, quota, []string{"song"})
+	if _, ok := quotaRetryAt(err); !ok {
+		t.Errorf("err = %v, want a quota error", err)
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("made %d requests with no quota left", len(fake.requests))
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/bwmarrin/discordgo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ballotEmoji are the reactions members vote with; Discord allows 20 different reactions on a message
+var ballotEmoji = []string{
+	"🇦", "🇧", "🇨", "🇩", "🇪", "🇫", "🇬", "🇭", "🇮", "🇯",
+	"🇰", "🇱", "🇲", "🇳", "🇴", "🇵", "🇶", "🇷", "🇸", "🇹",
+}
+
+// ballot ties a posted message's reactions back to the picks they vote for, stored in musicballots keyed by message ID
+type ballot struct {
+	GuildID   string            `firestore:"guildID"`
+	ChannelID string            `firestore:"channelID"`
+	Month     string            `firestore:"month"`
+	Day       int               `firestore:"day"`
+	Entries   map[string]string `firestore:"entries"`
+	Owners    map[string]string `firestore:"owners"`
+}
+
+// vote is a member's single vote for a day, stored in musicvotes
+type vote struct {
+	VoterID  string `firestore:"voterID"`
+	Month    string `firestore:"month"`
+	Day      int    `firestore:"day"`
+	SongID   string `firestore:"songID"`
+	SongUser string `firestore:"songUserID"`
+	Emoji    string `firestore:"emoji"`
+	Ballot   string `firestore:"ballotID"`
+}
+
+func voteID(monthName string, day int, voterID string) string {
+	return fmt.Sprintf("%v_%d_%v", monthName, day, voterID)
+}
+
+// postPicks posts a day's picks as embeds of up to 20 songs, opening each up for votes if asked. It returns an error if
+// none of them could be posted
+func postPicks(guildID, channelID, title string, monthName string, day int, subs []submission, voting bool) error {
+	subs = enrichSubmissions(subs)
+	for start := 0; start < len(subs); start += len(ballotEmoji) {
+		end := start + len(ballotEmoji)
+		if end > len(subs) {
+			end = len(subs)
+		}
+		chunk := subs[start:end]
+
+		var description strings.Builder
+		for n, sub := range chunk {
+			if voting {
+				description.WriteString(ballotEmoji[n] + " ")
+			}
+			// Keep every pick on the ballot however long their titles, leaving room for the emoji and newline
+			description.WriteString(truncate("<@"+sub.UserID+">: "+sub.describe(), maxEmbedDescriptionLength/len(ballotEmoji)-5) + "\n")
+		}
+		footer := strconv.Itoa(len(subs)) + " picks"
+		if voting {
+			footer += " - react to vote for your favourite (one vote each, and not for yourself!)"
+		}
+
+		msg, err := session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+			Embed: &discordgo.MessageEmbed{
+				Title:       truncate(title, maxEmbedTitleLength),
+				Description: description.String(),
+				Footer:      &discordgo.MessageEmbedFooter{Text: footer},
+			},
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err != nil {
+			log.Printf("Error posting picks: %v", err)
+			if start == 0 {
+				return err
+			}
+			// Posting the ones that went out again would only muddle the votes
+			return nil
+		}
+		if !voting {
+			continue
+		}
+
+		b := ballot{
+			GuildID:   guildID,
+			ChannelID: channelID,
+			Month:     monthName,
+			Day:       day,
+			Entries:   map[string]string{},
+			Owners:    map[string]string{},
+		}
+		for n, sub := range chunk {
+			b.Entries[ballotEmoji[n]] = sub.ID
+			b.Owners[ballotEmoji[n]] = sub.UserID
+		}
+		if _, err := firestoreClient.Collection("musicballots").Doc(msg.ID).Set(ctx, b); err != nil {
+			log.Printf("Error saving record to Firestore: %v", err)
+			continue
+		}
+		for n := range chunk {
+			if err := session.MessageReactionAdd(channelID, msg.ID, ballotEmoji[n]); err != nil {
+				log.Printf("Couldn't add a voting reaction: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// errPickGone means someone voted for a pick that's no longer there
+var errPickGone = errors.New("pick no longer exists")
+
+func loadBallot(messageID string) (*ballot, bool) {
+	doc, err := firestoreClient.Collection("musicballots").Doc(messageID).Get(ctx)
+	if err != nil {
+		return nil, false
+	}
+	var b ballot
+	if err := doc.DataTo(&b); err != nil {
+		return nil, false
+	}
+	return &b, true
+}
+
+// deletePick deletes a pick along with every vote cast for it, so voters are free to vote for something else that day
+func deletePick(ref *firestore.DocumentRef) error {
+	return firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		votes, err := tx.Documents(firestoreClient.Collection("musicvotes").Where("songID", "==", ref.ID)).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, v := range votes {
+			if err := tx.Delete(v.Ref); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(ref)
+	})
+}
+
+func handleVoteAdd(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	if firestoreClient == nil || r.UserID == s.State.User.ID {
+		return
+	}
+	b, ok := loadBallot(r.MessageID)
+	if !ok {
+		return
+	}
+	songID, ok := b.Entries[r.Emoji.Name]
+	if !ok {
+		return
+	}
+	if b.Owners[r.Emoji.Name] == r.UserID {
+		// No voting for yourself
+		s.MessageReactionRemove(r.ChannelID, r.MessageID, r.Emoji.Name, r.UserID)
+		return
+	}
+
+	var previous *vote
+	voteRef := firestoreClient.Collection("musicvotes").Doc(voteID(b.Month, b.Day, r.UserID))
+	songRef := firestoreClient.Collection("music").Doc(songID)
+	err := firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		previous = nil
+		song, err := tx.Get(songRef)
+		if status.Code(err) == codes.NotFound {
+			return errPickGone
+		}
+		if err != nil {
+			return err
+		}
+		doc, err := tx.Get(voteRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var v vote
+			if err := doc.DataTo(&v); err != nil {
+				return err
+			}
+			if v.SongID == songID {
+				return nil
+			}
+			previous = &v
+		}
+		// The old pick may have since been replaced, in which case there's nothing to take the vote back from
+		var previousSong *firestore.DocumentSnapshot
+		if previous != nil {
+			previousSong, err = tx.Get(firestoreClient.Collection("music").Doc(previous.SongID))
+			if err != nil && status.Code(err) != codes.NotFound {
+				return err
+			}
+		}
+		if previousSong != nil && previousSong.Exists() {
+			if err := tx.Update(previousSong.Ref, []firestore.Update{{Path: "votes", Value: firestore.Increment(-1)}}); err != nil {
+				return err
+			}
+		}
+		if err := tx.Update(song.Ref, []firestore.Update{{Path: "votes", Value: firestore.Increment(1)}}); err != nil {
+			return err
+		}
+		return tx.Set(voteRef, vote{
+			VoterID:  r.UserID,
+			Month:    b.Month,
+			Day:      b.Day,
+			SongID:   songID,
+			SongUser: b.Owners[r.Emoji.Name],
+			Emoji:    r.Emoji.Name,
+			Ballot:   r.MessageID,
+		})
+	})
+	if errors.Is(err, errPickGone) {
+		// The pick's been withdrawn or replaced since the ballot went up, so there's nothing to vote for
+		s.MessageReactionRemove(r.ChannelID, r.MessageID, r.Emoji.Name, r.UserID)
+		return
+	}
+	if err != nil {
+		log.Printf("Error recording a vote: %v", err)
+		return
+	}
+
+	// One vote per day, so take back the reaction for their old favourite
+	if previous != nil {
+		prevBallot, ok := b, true
+		if previous.Ballot != r.MessageID {
+			prevBallot, ok = loadBallot(previous.Ballot)
+		}
+		if ok {
+			s.MessageReactionRemove(prevBallot.ChannelID, previous.Ballot, previous.Emoji, r.UserID)
+		}
+	}
+}
+
+func handleVoteRemove(s *discordgo.Session, r *discordgo.MessageReactionRemove) {
+	if firestoreClient == nil || r.UserID == s.State.User.ID {
+		return
+	}
+	b, ok := loadBallot(r.MessageID)
+	if !ok {
+		return
+	}
+	songID, ok := b.Entries[r.Emoji.Name]
+	if !ok {
+		return
+	}
+
+	voteRef := firestoreClient.Collection("musicvotes").Doc(voteID(b.Month, b.Day, r.UserID))
+	err := firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(voteRef)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var v vote
+		if err := doc.DataTo(&v); err != nil {
+			return err
+		}
+		// Only withdraw the vote if this was the reaction it was cast with; we remove superseded reactions ourselves
+		if v.SongID != songID || v.Ballot != r.MessageID {
+			return nil
+		}
+		// The pick may have gone since, but the vote should still go with it
+		song, err := tx.Get(firestoreClient.Collection("music").Doc(songID))
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if err := tx.Update(song.Ref, []firestore.Update{{Path: "votes", Value: firestore.Increment(-1)}}); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(voteRef)
+	})
+	if err != nil {
+		log.Printf("Error withdrawing a vote: %v", err)
+	}
+}